@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	filldata "orders/other/fill-data"
+	"orders/src/broker"
 	"orders/src/broker/consumers"
+	"orders/src/config"
 	"orders/src/db"
 	"orders/src/db/repositories"
+	"orders/src/health"
 	httpserver "orders/src/http-server"
+	"orders/src/logger"
 	"orders/src/metrics"
 	"orders/src/mycache"
+	"orders/src/outbox"
 	"orders/src/service"
 	"orders/src/tracer"
 	customvalidator "orders/src/utils/custom-validator"
@@ -28,22 +33,40 @@ var Validate *validator.Validate
 func init() {
 	// loads values from .env into the system
 	if err := godotenv.Load(); err != nil {
-		log.Print("No .env file found")
+		slog.Info("no .env file found")
 	}
 
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fatal(slog.Default(), "migrate failed", err)
+		}
+
+		return
+	}
+
 	// Создаем контекст для безопастного завершения работы
 	ctx, stop := signal.NotifyContext(context.Background(),
 		os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
+	// Конфигурация: CONFIG_PATH (YAML) и переменные окружения
+	cfg, err := config.Load(os.Getenv("CONFIG_PATH"))
+	if err != nil {
+		fatal(slog.Default(), "load config failed", err)
+	}
+
+	// Логи в JSON; уровень меняется на лету через /admin/log/level. Стандартный log тоже пишет через этот логгер
+	log, level := newLogger(cfg.Log)
+	slog.SetDefault(log)
+
 	// Tracing
-	tp, err := tracer.InitTracer(os.Getenv("JAEGER_URL"), "Orders Service")
+	tp, err := tracer.InitTracer(ctx, cfg.Tracer)
 
 	if err != nil {
-		log.Printf("init tracer: %v\n", err)
+		log.Error("init tracer failed", "error", err)
 	}
 
 	// Метрики
@@ -55,70 +78,155 @@ func main() {
 	Validate, err := customvalidator.NewValidator()
 
 	if err != nil {
-		log.Printf("Error in create validator: %v\n", err)
+		log.Error("create validator failed", "error", err)
 	}
 
-	// Инициализация БД
-	db, err := db.NewDBConnection(ctx, tp, os.Getenv("DATABASE_URL"))
+	// Инициализация БД. Guard общий для репозиториев: лимит запросов по размеру пула, автомат и бюджет повторов
+	guard := db.NewGuard(cfg.DB, met, log)
+
+	db, err := db.NewDBConnection(ctx, tp, log, cfg.DB)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		fatal(log, "connect to database failed", err)
 	}
 
 	// Инициализация репозиториев
-	orderRepo := repositories.NewOrderRepo(db.Pool, met)
-	itemRepo := repositories.NewItemRepo(db.Pool, met)
-	paymentRepo := repositories.NewPaymentRepo(db.Pool, met)
-	deliveryRepo := repositories.NewDeliveryRepo(db.Pool, met)
+	orderRepo := repositories.NewOrderRepo(db.Pool, guard, met, log)
+	itemRepo := repositories.NewItemRepo(db.Pool, guard, met, log)
+	paymentRepo := repositories.NewPaymentRepo(db.Pool, guard, met, log)
+	deliveryRepo := repositories.NewDeliveryRepo(db.Pool, guard, met, log)
+	outboxRepo := repositories.NewOutboxRepo(db.Pool, guard, met)
 
 	// Инициализация redis
-	redis := mycache.NewRedis(tp, reg, met, time.Minute)
+	redis := mycache.NewRedis(tp, reg, met, log, cfg.Redis)
 
 	// Инициализация сервисов
-	ordersService := service.NewOrderService(orderRepo, redis, Validate)
-	itemService := service.NewItemService(itemRepo, redis, Validate)
-	paymentService := service.NewPaymentService(paymentRepo, redis, Validate)
-	deliveryService := service.NewDeliveryService(deliveryRepo, redis, Validate)
+	ordersService := service.NewOrderService(orderRepo, redis, Validate, log)
+	itemService := service.NewItemService(itemRepo, redis, Validate, log)
+	paymentService := service.NewPaymentService(paymentRepo, redis, Validate, log)
+	deliveryService := service.NewDeliveryService(deliveryRepo, redis, Validate, log)
+
+	listener := consumers.NewOrderConsumer(cfg.Kafka, met, tp, log, ordersService, deliveryService, itemService, paymentService)
+
+	// Проверки готовности: /readyz не проходит, пока недоступна зависимость или не прогрет кеш
+	var warmUp health.Flag
+
+	checker := health.NewChecker(cfg.Health.Timeout)
+	checker.Add("postgres", db.Ping)
+	// Без Redis сервис работает на локальном кеше: отказ переводит /readyz в degraded, но не снимает готовность
+	checker.AddOptional("redis", redis.Ping)
+	checker.Add("kafka", listener.Ping)
+	checker.Add("cache_warmup", warmUp.Check)
 
 	// Создание web-server
-	srv := httpserver.NewServer(ctx, met, ordersService)
+	srv := httpserver.NewServer(ctx, cfg.HTTP, met, checker, ordersService, log, level)
+
+	// Прогрев кеша до готовности, чтобы первые запросы не шли в БД
+	warmUpCache(ctx, cfg.WarmUp, ordersService, met, log)
+	warmUp.Done()
 
 	// Подписка на топик
-	listener := consumers.NewOrderConsumer(met, tp, ordersService, deliveryService, itemService, paymentService)
 	listener.Run(ctx)
 
-	// FILL DATA [DEBUG]
+	// Повторная обработка сообщений из DLQ
+	retrier := consumers.NewRetryConsumer(cfg.Kafka, met, tp, log, listener)
+	retrier.Run(ctx)
 
-	go func(ctx context.Context) {
-		filldata.FillData(ctx)
-	}(ctx)
+	// Публикация доменных событий из outbox
+	relay := outbox.NewRelay(cfg.Outbox, outboxRepo, broker.NewProducer(cfg.Kafka.Brokers, cfg.Outbox.Topic, cfg.Outbox.BatchSize), met, tp, log)
+	relay.Run(ctx)
+
+	// FILL DATA [DEBUG]
+	if cfg.FillData {
+		go func(ctx context.Context) {
+			filldata.FillData(ctx, cfg.Kafka.Brokers, cfg.Kafka.Topic)
+		}(ctx)
+	}
 
 	// Обработка закрытия  приложения
 	<-ctx.Done()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Error in srv.Shutdown: %v\n", err)
+	// Сначала /readyz отвечает 503, и только после паузы сервер перестает принимать запросы
+	checker.ShutDown()
+	log.Info("shutting down, draining traffic", "drain_delay", cfg.Health.DrainDelay)
+	time.Sleep(cfg.Health.DrainDelay)
+
+	// ctx уже отменен: на завершение HTTP-запросов дается отдельный таймаут
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("shutdown http server failed", "error", err)
 	}
 
-	if err1, err2 := listener.Close(); err != nil || err2 != nil {
+	if err1, err2 := listener.Close(); err1 != nil || err2 != nil {
 		if err1 != nil {
-			log.Printf("Error in reader.Close: %v\n", err1)
+			log.Error("close kafka reader failed", "error", err1)
 		}
 
 		if err2 != nil {
-			log.Printf("Error in writer.Close: %v\n", err2)
+			log.Error("close kafka writer failed", "error", err2)
 		}
 	}
 
+	if err1, err2 := retrier.Close(); err1 != nil || err2 != nil {
+		log.Error("close retry consumer failed", "reader_error", err1, "writer_error", err2)
+	}
+
+	if err := relay.Close(); err != nil {
+		log.Error("close outbox relay failed", "error", err)
+	}
+
 	if err := redis.Close(); err != nil {
-		log.Printf("Error in redis.Close: %v\n", err)
+		log.Error("close redis failed", "error", err)
 	}
 
 	if err := db.Close(); err != nil {
-		log.Printf("Error in db.Close: %v\n", err)
+		log.Error("close database failed", "error", err)
+	}
+
+	if err := tp.Shutdown(shutdownCtx); err != nil {
+		log.Error("shutdown tracer provider failed", "error", err)
 	}
 
-	if err := tp.Shutdown(ctx); err != nil {
-		log.Printf("Error in tp.Shutdown: %v\n", err)
+}
+
+// newLogger создает JSON-логгер из конфигурации. Уровень уже проверен при загрузке конфигурации
+func newLogger(cfg config.Log) (*slog.Logger, *slog.LevelVar) {
+	level, err := logger.NewLevel(cfg.Level)
+	if err != nil {
+		level = new(slog.LevelVar)
+	}
+
+	return logger.New(os.Stdout, level), level
+}
+
+// fatal пишет ошибку запуска и завершает процесс
+func fatal(log *slog.Logger, msg string, err error) {
+	log.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// warmUpCache загружает последние заказы в кеш; cfg.Orders = 0 выключает прогрев
+func warmUpCache(ctx context.Context, cfg config.WarmUp, ordersService service.OrderService, met *metrics.Metrics, log *slog.Logger) {
+	opts := service.WarmUpOptions{Limit: cfg.Orders, BatchSize: cfg.Batch, Window: cfg.Window}
+
+	if opts.Limit <= 0 {
+		return
+	}
+
+	start := time.Now()
+
+	warmed, err := ordersService.WarmUpCache(ctx, opts)
+
+	duration := time.Since(start)
+
+	met.CacheWarmupDuration.Set(duration.Seconds())
+	met.CacheWarmupOrders.Set(float64(warmed))
+
+	if err != nil {
+		log.ErrorContext(ctx, "cache warm-up failed", "warmed", warmed, "error", err)
+		return
 	}
 
+	log.InfoContext(ctx, "cache warm-up done", "warmed", warmed, "duration", duration)
 }
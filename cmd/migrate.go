@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"orders/src/config"
+	"orders/src/db"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = "usage: orders migrate up | down [N] | status"
+
+// runMigrate выполняет подкоманду migrate: up — применить все миграции, down [N] — откатить N последних (по умолчанию 1),
+// status — показать версию схемы
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	cfg, err := config.Load(os.Getenv("CONFIG_PATH"))
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	log, _ := newLogger(cfg.Log)
+
+	m, err := db.NewMigrator(cfg.DB.URL, log)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			log.Error("close migrator failed", "error", err)
+		}
+	}()
+
+	switch args[0] {
+	case "up":
+		if err := m.Up(); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("down: N must be a positive number, got %q", args[1])
+			}
+		}
+
+		if err := m.Down(steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\nlatest: %d\ndirty: %t\n", status.Version, status.Latest, status.Dirty)
+
+	return nil
+}
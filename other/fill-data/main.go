@@ -3,10 +3,9 @@ package filldata
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	randomid "orders/src/utils/random-id"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -14,12 +13,10 @@ type brokerSerive struct {
 	Writer *kafka.Writer
 }
 
-func createProvider() *brokerSerive {
-	fmt.Println(os.Getenv("KAFKA_HOST"))
-
+func createProvider(brokers []string, topic string) *brokerSerive {
 	w := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{os.Getenv("KAFKA_HOST")},
-		Topic:   "orders",
+		Brokers: brokers,
+		Topic:   topic,
 	})
 
 	return &brokerSerive{Writer: w}
@@ -41,123 +38,81 @@ func (broker *brokerSerive) writeMessages(ctx context.Context, messages []kafka.
 	}
 }
 
-func getDeliveryJSON() string {
-	json := `{
-		"name": "Sergey",
-		"phone": "+79235858077",
-		"zip": "12345",
-		"city": "Moscow",
-		"address": "Автозаводская 23с16",
-		"region": "Moscow",
-		"email": "test@test.com"
-		}`
-
-	return json
-}
-
-func getPaymentJSON() string {
-	json := `{
-		"transaction": "transaction",
-		"request_id": "1234",
-		"currency": "RUB",
-		"provider": "provider",
-		"amount": 100,
-		"payment_dt": 100,
-		"bank": "Т-Банк",
-		"delivery_cost": 100,
-		"goods_total": 100,
-		"custom_fee": 100
-		}`
-
-	return json
-}
-
-func getItemsJSON() string {
-	json := `{
-		"chrt_id": 1,
-		"track_number": "HEYEDSADSa",
-		"price": 200,
-		"rid": "RIDRIDRID",
-		"name": "Sergey",
-		"sale": 50,
-		"size": "100",
-		"nm_id": 123,
-		"total_price": 500,
-		"brand": "SUPERBRAND",
-		"status": 1,
-		"order_id": 1
-		}`
-
-	return json
-}
-
-func getOrderJSON() string {
-	json := `{
-		"order_uid": "SKDMALSDMLSA",
-		"track_number": "KEIEIIEIE",
-		"entry": "HEY",
+func getOrderJSON(orderUID string, created time.Time) string {
+	json := fmt.Sprintf(`{
+		"order_uid": "%[1]s",
+		"track_number": "WBILMTESTTRACK",
+		"entry": "WBIL",
+		"delivery": {
+			"name": "Sergey",
+			"phone": "+79235858077",
+			"zip": "12345",
+			"city": "Moscow",
+			"address": "Автозаводская 23с16",
+			"region": "Moscow",
+			"email": "test@test.com"
+		},
+		"payment": {
+			"transaction": "%[1]s",
+			"request_id": "1234",
+			"currency": "RUB",
+			"provider": "wbpay",
+			"amount": 300,
+			"payment_dt": %[3]d,
+			"bank": "Т-Банк",
+			"delivery_cost": 100,
+			"goods_total": 100,
+			"custom_fee": 100
+		},
+		"items": [
+			{
+				"chrt_id": 9934930,
+				"track_number": "WBILMTESTTRACK",
+				"price": 200,
+				"rid": "RID%[1]s",
+				"name": "Mascaras",
+				"sale": 50,
+				"size": "0",
+				"total_price": 100,
+				"nm_id": 2389212,
+				"brand": "VivienneSabo",
+				"status": 202
+			}
+		],
 		"locale": "US",
-		"internal_signature": "HEYSADA",
-		"customer_id": "123",
-		"delivery_service": "WBTWIN",
-		"shardkey": "44412",
-		"sm_id": 123,
-		"date_created": "2021-11-26T06:22:19Z",
-		"oof_shard": "123312",
-		"delivery_id": 1,
-		"payment_id": 1
-		}`
+		"internal_signature": "",
+		"customer_id": "test",
+		"delivery_service": "meest",
+		"shardkey": "9",
+		"sm_id": 99,
+		"date_created": "%[2]s",
+		"oof_shard": "1"
+		}`, orderUID, created.Format(time.RFC3339), created.Unix())
 
 	return json
 }
 
 func writeMessages(ctx context.Context, brokerService *brokerSerive) {
 
-	payment := getPaymentJSON()
-	delivery := getDeliveryJSON()
-	items := getItemsJSON()
-	order := getOrderJSON()
-
 	var messages []kafka.Message
 
 	for range 100 {
-		messagePayment := kafka.Message{
-			Key:   []byte("payment"),
-			Value: []byte(payment),
-		}
-
-		messageDelivery := kafka.Message{
-			Key:   []byte("delivery"),
-			Value: []byte(delivery),
-		}
-
-		messageItem := kafka.Message{
-			Key:   []byte("item"),
-			Value: []byte(items),
-		}
-
-		messageOrder := kafka.Message{
-			Key:   []byte("order"),
-			Value: []byte(order),
-		}
-
-		messages = append(messages, messagePayment, messageDelivery, messageItem, messageOrder)
+		orderUID := randomid.New(10)
+
+		// Ключ — order_uid: сообщения одного заказа попадают в одну партицию
+		messages = append(messages, kafka.Message{
+			Key:   []byte(orderUID),
+			Value: []byte(getOrderJSON(orderUID, time.Now().UTC())),
+		})
 	}
 
 	brokerService.writeMessages(ctx, messages)
 }
 
-func init() {
-	// loads values from .env into the system
-	if err := godotenv.Load(".env.dev"); err != nil {
-		log.Print("No .env file found")
-	}
-}
-
-func FillData(ctx context.Context) {
+func FillData(ctx context.Context, brokers []string, topic string) {
 
 	// Init provider
-	brokerService := *createProvider()
+	brokerService := *createProvider(brokers, topic)
 	defer brokerService.close()
 
 	// Write messages
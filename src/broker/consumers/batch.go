@@ -0,0 +1,112 @@
+package consumers
+
+import (
+	"context"
+	"orders/src/broker"
+	"orders/src/logger"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// handleBatch сохраняет вместе только подряд идущие агрегаты, чтобы не нарушить порядок внутри заказа
+func (c *OrderConsumer) handleBatch(ctx context.Context, batch []*kafka.Message) {
+	for _, run := range splitRuns(batch) {
+		if len(run) == 1 {
+			c.handle(ctx, run[0])
+			continue
+		}
+
+		c.flush(ctx, run)
+	}
+}
+
+func splitRuns(batch []*kafka.Message) [][]*kafka.Message {
+	var runs [][]*kafka.Message
+	var run []*kafka.Message
+
+	for _, msg := range batch {
+		if messageKind(msg) == keyAggregate {
+			run = append(run, msg)
+			continue
+		}
+
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = nil
+		}
+
+		runs = append(runs, []*kafka.Message{msg})
+	}
+
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	return runs
+}
+
+// flush при ошибке пачки обрабатывает сообщения по одному, чтобы в DLQ ушел только виновник
+func (c *OrderConsumer) flush(ctx context.Context, batch []*kafka.Message) {
+	topic := c.broker.Topic()
+
+	links := make([]oteltrace.Link, 0, len(batch))
+
+	for _, msg := range batch {
+		links = append(links, oteltrace.LinkFromContext(c.broker.Trace(ctx, msg)))
+	}
+
+	tr := c.tp.Tracer("orders-consumer")
+	batchCtx, span := tr.Start(ctx, "handle-order-batch", oteltrace.WithLinks(links...))
+	defer span.End()
+
+	start := time.Now()
+	err := c.saveBatch(batchCtx, batch)
+	lat := time.Since(start).Seconds()
+
+	c.metrics.KafkaBatchSize.WithLabelValues(topic).Observe(float64(len(batch)))
+
+	if err == nil {
+		c.metrics.KafkaBatchFlushDuration.WithLabelValues(topic, "success").Observe(lat)
+		c.metrics.KafkaMessagesConsumed.WithLabelValues(topic, "success").Add(float64(len(batch)))
+
+		for _, msg := range batch {
+			c.commit(logger.WithAttrs(batchCtx, messageAttrs(msg)...), msg)
+		}
+
+		return
+	}
+
+	c.metrics.KafkaBatchFlushDuration.WithLabelValues(topic, "error").Observe(lat)
+
+	if ctx.Err() != nil {
+		c.log.WarnContext(batchCtx, "batch left uncommitted", "size", len(batch), "error", err)
+		return
+	}
+
+	c.metrics.KafkaBatchFallbacks.WithLabelValues(topic).Inc()
+	c.log.WarnContext(batchCtx, "batch failed, handling messages one by one", "size", len(batch), "error", err)
+
+	for _, msg := range batch {
+		c.handle(ctx, msg)
+	}
+}
+
+func (c *OrderConsumer) saveBatch(ctx context.Context, batch []*kafka.Message) error {
+	orders := make([]*broker.OrderMessage, 0, len(batch))
+
+	for _, msg := range batch {
+		var order broker.OrderMessage
+
+		if err := decode(msg, &order); err != nil {
+			return err
+		}
+
+		orders = append(orders, &order)
+	}
+
+	_, err := c.orderService.CreateOrderAggregates(ctx, orders)
+
+	return err
+}
@@ -0,0 +1,41 @@
+package consumers
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRuns(t *testing.T) {
+	msg := func(key string, offset int64) *kafka.Message {
+		return &kafka.Message{Key: []byte(key), Offset: offset}
+	}
+
+	offsets := func(runs [][]*kafka.Message) [][]int64 {
+		var out [][]int64
+
+		for _, run := range runs {
+			var offs []int64
+			for _, m := range run {
+				offs = append(offs, m.Offset)
+			}
+
+			out = append(out, offs)
+		}
+
+		return out
+	}
+
+	batch := []*kafka.Message{
+		msg("uid-1", 0), msg("uid-2", 1),
+		msg(keyPayment, 2),
+		msg("uid-3", 3),
+		msg(keyOrder, 4), msg(keyItem, 5),
+		msg("uid-4", 6), msg("uid-5", 7),
+	}
+
+	// Поэлементные сообщения разрывают группы агрегатов и обрабатываются на своем месте в порядке чтения
+	require.Equal(t, [][]int64{{0, 1}, {2}, {3}, {4}, {5}, {6, 7}}, offsets(splitRuns(batch)))
+	require.Equal(t, [][]int64{{0}}, offsets(splitRuns(batch[:1])))
+}
@@ -0,0 +1,152 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Способы раскладки сообщений по воркерам (config.Kafka.ShardBy)
+const (
+	ShardByKey       = "key"
+	ShardByPartition = "partition"
+)
+
+// dispatcher отдает сообщения с одним ключом шарда одному воркеру, чтобы они обрабатывались по порядку
+type dispatcher struct {
+	queues []chan *kafka.Message
+	shard  func(msg *kafka.Message) string
+	wg     sync.WaitGroup
+}
+
+// newDispatcher: после отмены ctx оставшиеся в очередях сообщения пропускаются и не коммитятся
+func newDispatcher(ctx context.Context, workers, queueSize int, shardBy string, batchSize int, linger time.Duration,
+	handle func(ctx context.Context, batch []*kafka.Message)) *dispatcher {
+	d := &dispatcher{queues: make([]chan *kafka.Message, workers), shard: shardKey}
+
+	if shardBy == ShardByPartition {
+		d.shard = partitionKeyOf
+	}
+
+	d.wg.Add(workers)
+
+	for i := range d.queues {
+		queue := make(chan *kafka.Message, queueSize)
+		d.queues[i] = queue
+
+		go func() {
+			defer d.wg.Done()
+
+			for {
+				batch, open := collect(ctx, queue, batchSize, linger)
+
+				if len(batch) > 0 && ctx.Err() == nil {
+					handle(ctx, batch)
+				}
+
+				if !open {
+					return
+				}
+			}
+		}()
+	}
+
+	return d
+}
+
+// collect добирает пачку до size сообщений не дольше linger; open = false — очередь закрыта и пуста
+func collect(ctx context.Context, queue <-chan *kafka.Message, size int, linger time.Duration) (batch []*kafka.Message, open bool) {
+	msg, ok := <-queue
+	if !ok {
+		return nil, false
+	}
+
+	batch = make([]*kafka.Message, 1, size)
+	batch[0] = msg
+
+	if size == 1 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(linger)
+	defer timer.Stop()
+
+	for len(batch) < size {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				return batch, false
+			}
+
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch, true
+		case <-ctx.Done():
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+func (d *dispatcher) dispatch(ctx context.Context, msg *kafka.Message) error {
+	// select выбирает случайно: без проверки сообщение могло бы попасть в очередь уже после отмены
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case d.queues[d.worker(msg)] <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *dispatcher) worker(msg *kafka.Message) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(d.shard(msg)))
+
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// close вызывается после последнего dispatch
+func (d *dispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+
+	d.wg.Wait()
+}
+
+func partitionKeyOf(msg *kafka.Message) string {
+	return msg.Topic + "/" + strconv.Itoa(msg.Partition)
+}
+
+type orderRef struct {
+	OrderUID string `json:"order_uid"`
+}
+
+// shardKey — order_uid агрегата. Из поэлементных сообщений заказ не собрать, они шардируются по партиции
+func shardKey(msg *kafka.Message) string {
+	switch key := string(msg.Key); key {
+	case keyOrder, keyPayment, keyItem, keyDelivery:
+		return partitionKeyOf(msg)
+	case "":
+	default:
+		return "order_uid:" + key
+	}
+
+	var ref orderRef
+
+	if err := json.Unmarshal(msg.Value, &ref); err == nil && ref.OrderUID != "" {
+		return "order_uid:" + ref.OrderUID
+	}
+
+	return partitionKeyOf(msg)
+}
@@ -0,0 +1,152 @@
+package consumers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardKey(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  kafka.Message
+		want string
+	}{
+		{"aggregate key", kafka.Message{Key: []byte("b563feb7b2b84b6test"), Value: []byte(`{`)}, "order_uid:b563feb7b2b84b6test"},
+		{"aggregate without key", kafka.Message{Value: []byte(`{"order_uid":"b563feb7b2b84b6test"}`)}, "order_uid:b563feb7b2b84b6test"},
+		{"aggregate without order", kafka.Message{Topic: "orders", Partition: 1, Value: []byte(`{"order_id":7}`)}, "orders/1"},
+		// Заказ и его оплата шардируются одинаково, хотя в теле у них разные поля заказа
+		{"legacy order", kafka.Message{Topic: "orders", Partition: 2, Key: []byte(keyOrder), Value: []byte(`{"order_uid":"b563feb7b2b84b6test"}`)}, "orders/2"},
+		{"legacy payment", kafka.Message{Topic: "orders", Partition: 2, Key: []byte(keyPayment), Value: []byte(`{"transaction":"t1","order_id":7}`)}, "orders/2"},
+		{"legacy item", kafka.Message{Topic: "orders", Partition: 2, Key: []byte(keyItem), Value: []byte(`{"rid":"r1","order_id":7}`)}, "orders/2"},
+		{"broken json", kafka.Message{Topic: "orders", Partition: 3, Key: []byte(keyDelivery), Value: []byte(`{`)}, "orders/3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, shardKey(&c.msg))
+		})
+	}
+}
+
+func TestDispatcher_PreservesOrderPerKey(t *testing.T) {
+	var mu sync.Mutex
+	handled := make(map[string][]int64)
+
+	d := newDispatcher(context.Background(), 4, 2, ShardByKey, 1, time.Millisecond, func(_ context.Context, batch []*kafka.Message) {
+		msg := batch[0]
+
+		// Разное время обработки перемешало бы сообщения, если бы одного ключа касались несколько воркеров
+		time.Sleep(time.Duration(msg.Offset%3) * time.Millisecond)
+
+		mu.Lock()
+		handled[string(msg.Key)] = append(handled[string(msg.Key)], msg.Offset)
+		mu.Unlock()
+	})
+
+	keys := []string{"uid-a", "uid-b", "uid-c", "uid-d", "uid-e"}
+
+	for offset := int64(0); offset < 50; offset++ {
+		msg := &kafka.Message{Key: []byte(keys[offset%int64(len(keys))]), Offset: offset}
+		require.NoError(t, d.dispatch(context.Background(), msg))
+	}
+
+	d.close()
+
+	for i, key := range keys {
+		var want []int64
+		for offset := int64(i); offset < 50; offset += int64(len(keys)) {
+			want = append(want, offset)
+		}
+
+		require.Equal(t, want, handled[key], key)
+	}
+}
+
+func TestDispatcher_ShardsRunInParallel(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+
+	d := newDispatcher(context.Background(), 2, 0, ShardByPartition, 1, time.Millisecond, func(_ context.Context, _ []*kafka.Message) {
+		peak.Store(max(peak.Load(), running.Add(1)))
+		<-release
+		running.Add(-1)
+	})
+
+	// Партиции 0 и 1 попадают к разным воркерам: fnv("orders/0") и fnv("orders/1") различаются по модулю 2
+	require.NotEqual(t, d.worker(newMessage(0, 0)), d.worker(newMessage(1, 0)))
+
+	require.NoError(t, d.dispatch(context.Background(), newMessage(0, 0)))
+	require.NoError(t, d.dispatch(context.Background(), newMessage(1, 0)))
+
+	require.Eventually(t, func() bool { return peak.Load() == 2 }, time.Second, time.Millisecond)
+
+	close(release)
+	d.close()
+}
+
+func TestDispatcher_SkipsQueuedAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var handled atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	d := newDispatcher(ctx, 1, 4, ShardByPartition, 1, time.Millisecond, func(_ context.Context, _ []*kafka.Message) {
+		if handled.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+	})
+
+	for offset := int64(0); offset < 3; offset++ {
+		require.NoError(t, d.dispatch(ctx, newMessage(0, offset)))
+	}
+
+	<-started
+	cancel()
+	close(release)
+
+	// После отмены сообщения не принимаются, даже если в очереди есть место
+	require.ErrorIs(t, d.dispatch(ctx, newMessage(0, 3)), context.Canceled)
+
+	d.close()
+	require.Equal(t, int32(1), handled.Load())
+}
+
+func TestDispatcher_CollectsBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int64
+
+	d := newDispatcher(context.Background(), 1, 8, ShardByPartition, 3, 20*time.Millisecond, func(_ context.Context, batch []*kafka.Message) {
+		offsets := make([]int64, 0, len(batch))
+		for _, msg := range batch {
+			offsets = append(offsets, msg.Offset)
+		}
+
+		mu.Lock()
+		batches = append(batches, offsets)
+		mu.Unlock()
+	})
+
+	for offset := int64(0); offset < 4; offset++ {
+		require.NoError(t, d.dispatch(context.Background(), newMessage(0, offset)))
+	}
+
+	// Неполная пачка уходит по истечении linger, не дожидаясь закрытия очереди
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(batches) == 2
+	}, time.Second, time.Millisecond)
+
+	d.close()
+
+	require.Equal(t, [][]int64{{0, 1, 2}, {3}}, batches)
+}
@@ -0,0 +1,189 @@
+package consumers
+
+import (
+	"context"
+	"log/slog"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type position struct {
+	highWaterMark int64
+	committed     int64
+}
+
+// lagTracker считает отставание по партициям: ReaderStats в режиме группы знает его только по всему reader
+type lagTracker struct {
+	mu        sync.Mutex
+	metrics   *metrics.Metrics
+	positions map[partitionKey]*position
+	rebalance chan struct{} // закрывается при ребалансировке
+}
+
+func newLagTracker(m *metrics.Metrics) *lagTracker {
+	return &lagTracker{metrics: m, positions: make(map[partitionKey]*position), rebalance: make(chan struct{})}
+}
+
+func (t *lagTracker) rebalanced() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.rebalance
+}
+
+// fetched: до первого коммита позицией группы считается первое прочитанное сообщение
+func (t *lagTracker) fetched(msg *kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+
+	pos, ok := t.positions[key]
+	if !ok {
+		pos = &position{committed: msg.Offset}
+		t.positions[key] = pos
+	}
+
+	pos.highWaterMark = max(pos.highWaterMark, msg.HighWaterMark)
+
+	t.report(key, pos)
+}
+
+func (t *lagTracker) committed(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+
+	pos, ok := t.positions[key]
+	if !ok {
+		pos = &position{highWaterMark: msg.HighWaterMark}
+		t.positions[key] = pos
+	}
+
+	pos.committed = max(pos.committed, msg.Offset+1)
+
+	t.report(key, pos)
+}
+
+func (t *lagTracker) partitions(topic string) []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var partitions []int
+
+	for key := range t.positions {
+		if key.topic == topic {
+			partitions = append(partitions, key.partition)
+		}
+	}
+
+	return partitions
+}
+
+// watermarks не возвращает партиции, забытые после ребалансировки
+func (t *lagTracker) watermarks(topic string, marks map[int]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for partition, mark := range marks {
+		key := partitionKey{topic: topic, partition: partition}
+
+		pos, ok := t.positions[key]
+		if !ok {
+			continue
+		}
+
+		pos.highWaterMark = max(pos.highWaterMark, mark)
+
+		t.report(key, pos)
+	}
+}
+
+// reset забывает партиции: часть из них могла уйти другому инстансу
+func (t *lagTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.positions {
+		partition := strconv.Itoa(key.partition)
+
+		t.metrics.KafkaConsumerLag.DeleteLabelValues(key.topic, partition)
+		t.metrics.KafkaCommittedOffset.DeleteLabelValues(key.topic, partition)
+	}
+
+	clear(t.positions)
+
+	close(t.rebalance)
+	t.rebalance = make(chan struct{})
+}
+
+func (t *lagTracker) report(key partitionKey, pos *position) {
+	partition := strconv.Itoa(key.partition)
+
+	t.metrics.KafkaConsumerLag.WithLabelValues(key.topic, partition).Set(float64(max(pos.highWaterMark-pos.committed, 0)))
+	t.metrics.KafkaCommittedOffset.WithLabelValues(key.topic, partition).Set(float64(pos.committed))
+}
+
+type statsSource interface {
+	Topic() string
+	Stats() kafka.ReaderStats
+	HighWaterMarks(ctx context.Context, partitions []int) (map[int]int64, error)
+}
+
+// watchStats запрашивает high watermark сам, иначе отставание замирало бы, когда чтение стоит.
+// Stats сбрасывает счетчики при каждом вызове, поэтому вызывающий должен быть один
+func watchStats(ctx context.Context, src statsSource, m *metrics.Metrics, lag *lagTracker, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			observeStats(src.Topic(), src.Stats(), m, lag)
+
+			if err := refreshWatermarks(ctx, src, lag, interval); err != nil && ctx.Err() == nil {
+				log.WarnContext(ctx, "refresh high watermarks failed", logger.KeyTopic, src.Topic(), "error", err)
+			}
+		}
+	}
+}
+
+func refreshWatermarks(ctx context.Context, src statsSource, lag *lagTracker, timeout time.Duration) error {
+	partitions := lag.partitions(src.Topic())
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	marks, err := src.HighWaterMarks(ctx, partitions)
+	if err != nil {
+		return err
+	}
+
+	lag.watermarks(src.Topic(), marks)
+
+	return nil
+}
+
+func observeStats(topic string, stats kafka.ReaderStats, m *metrics.Metrics, lag *lagTracker) {
+	if stats.Rebalances > 0 {
+		m.KafkaRebalances.WithLabelValues(topic).Add(float64(stats.Rebalances))
+		lag.reset()
+	}
+
+	// Без чтений за интервал задержка не определена: остаются прошлые значения
+	if stats.ReadTime.Count > 0 {
+		m.KafkaFetchLatency.WithLabelValues(topic, "avg").Set(stats.ReadTime.Avg.Seconds())
+		m.KafkaFetchLatency.WithLabelValues(topic, "max").Set(stats.ReadTime.Max.Seconds())
+	}
+}
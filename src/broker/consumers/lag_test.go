@@ -0,0 +1,119 @@
+package consumers
+
+import (
+	"context"
+	"orders/src/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newLagMetrics() *metrics.Metrics {
+	reg := prometheus.NewRegistry()
+	return metrics.New(reg, reg)
+}
+
+func fetchedMessage(partition int, offset, highWaterMark int64) *kafka.Message {
+	msg := newMessage(partition, offset)
+	msg.HighWaterMark = highWaterMark
+
+	return msg
+}
+
+func TestLagTracker_ByPartition(t *testing.T) {
+	m := newLagMetrics()
+	lag := newLagTracker(m)
+
+	// До первого коммита все сообщения, начиная с прочитанного, считаются отставанием
+	lag.fetched(fetchedMessage(0, 10, 15))
+	lag.fetched(fetchedMessage(1, 3, 4))
+
+	require.Equal(t, float64(5), testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "1")))
+
+	// Коммит 10 означает, что следующим будет прочитано 11
+	lag.committed(*fetchedMessage(0, 10, 15))
+	require.Equal(t, float64(11), testutil.ToFloat64(m.KafkaCommittedOffset.WithLabelValues("orders", "0")))
+	require.Equal(t, float64(4), testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+
+	// Новые сообщения в партиции увеличивают отставание, коммит последнего обнуляет его
+	lag.fetched(fetchedMessage(0, 11, 20))
+	require.Equal(t, float64(9), testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+
+	lag.committed(*fetchedMessage(0, 19, 20))
+	require.Zero(t, testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+
+	// Коммит старого оффсета, завершившийся позже, не откатывает позицию
+	lag.committed(*fetchedMessage(0, 12, 20))
+	require.Equal(t, float64(20), testutil.ToFloat64(m.KafkaCommittedOffset.WithLabelValues("orders", "0")))
+}
+
+func TestObserveStats_RebalanceResetsPartitions(t *testing.T) {
+	m := newLagMetrics()
+	lag := newLagTracker(m)
+
+	lag.fetched(fetchedMessage(0, 1, 2))
+	lag.fetched(fetchedMessage(1, 1, 2))
+	require.Equal(t, 2, testutil.CollectAndCount(m.KafkaConsumerLag))
+
+	observeStats("orders", kafka.ReaderStats{
+		Rebalances: 2,
+		ReadTime:   kafka.DurationStats{Count: 3, Avg: 20 * time.Millisecond, Max: 50 * time.Millisecond},
+	}, m, lag)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.KafkaRebalances.WithLabelValues("orders")))
+	require.Equal(t, 0.02, testutil.ToFloat64(m.KafkaFetchLatency.WithLabelValues("orders", "avg")))
+	require.Equal(t, 0.05, testutil.ToFloat64(m.KafkaFetchLatency.WithLabelValues("orders", "max")))
+
+	// Партиции могли уйти другому инстансу: их серии пропадают до следующего чтения
+	require.Zero(t, testutil.CollectAndCount(m.KafkaConsumerLag))
+	require.Zero(t, testutil.CollectAndCount(m.KafkaCommittedOffset))
+
+	// Интервал без чтений и ребалансировок не меняет метрики
+	observeStats("orders", kafka.ReaderStats{}, m, lag)
+	require.Equal(t, float64(2), testutil.ToFloat64(m.KafkaRebalances.WithLabelValues("orders")))
+	require.Equal(t, 0.05, testutil.ToFloat64(m.KafkaFetchLatency.WithLabelValues("orders", "max")))
+}
+
+// fakeStatsSource отдает заданные high watermark партиций
+type fakeStatsSource struct {
+	marks     map[int]int64
+	requested []int
+}
+
+func (s *fakeStatsSource) Topic() string { return "orders" }
+
+func (s *fakeStatsSource) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+
+func (s *fakeStatsSource) HighWaterMarks(_ context.Context, partitions []int) (map[int]int64, error) {
+	s.requested = partitions
+	return s.marks, nil
+}
+
+func TestRefreshWatermarks_GrowsLagWithoutFetches(t *testing.T) {
+	m := newLagMetrics()
+	lag := newLagTracker(m)
+
+	lag.fetched(fetchedMessage(0, 10, 11))
+	lag.committed(*fetchedMessage(0, 10, 11))
+	require.Zero(t, testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+
+	// Чтение стоит, а в партицию продолжают писать: отставание растет по ответу брокера.
+	// Партиция 1 этому инстансу не назначена и не появляется
+	src := &fakeStatsSource{marks: map[int]int64{0: 25, 1: 7}}
+	require.NoError(t, refreshWatermarks(context.Background(), src, lag, time.Second))
+
+	require.Equal(t, []int{0}, src.requested)
+	require.Equal(t, float64(14), testutil.ToFloat64(m.KafkaConsumerLag.WithLabelValues("orders", "0")))
+	require.Equal(t, 1, testutil.CollectAndCount(m.KafkaConsumerLag))
+}
+
+func TestMessageKind(t *testing.T) {
+	require.Equal(t, keyPayment, messageKind(&kafka.Message{Key: []byte(keyPayment)}))
+	require.Equal(t, keyAggregate, messageKind(&kafka.Message{Key: []byte("b563feb7b2b84b6test")}))
+	require.Equal(t, keyAggregate, messageKind(&kafka.Message{}))
+}
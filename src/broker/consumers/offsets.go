@@ -0,0 +1,85 @@
+package consumers
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type partitionOffsets struct {
+	pending  []int64            // оффсеты в обработке в порядке чтения
+	finished map[int64]struct{} // обработанные оффсеты, которые ждут более ранних
+}
+
+// offsetTracker отдает оффсет на коммит, только когда обработаны все более ранние сообщения партиции
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+func (t *offsetTracker) track(msg *kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+	state, ok := t.partitions[key]
+
+	// Партицию перечитывают с последнего коммита после ребалансировки, которую еще не заметил watchStats
+	if !ok || (len(state.pending) > 0 && msg.Offset <= state.pending[len(state.pending)-1]) {
+		state = &partitionOffsets{finished: make(map[int64]struct{})}
+		t.partitions[key] = state
+	}
+
+	state.pending = append(state.pending, msg.Offset)
+}
+
+// reset: завершение сообщений старого поколения не должно ничего коммитить
+func (t *offsetTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clear(t.partitions)
+}
+
+// done возвращает наибольший оффсет, до которого включительно партицию можно закоммитить
+func (t *offsetTracker) done(msg *kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.partitions[partitionKey{topic: msg.Topic, partition: msg.Partition}]
+	if !ok {
+		return kafka.Message{}, false
+	}
+
+	i := sort.Search(len(state.pending), func(i int) bool { return state.pending[i] >= msg.Offset })
+	if i == len(state.pending) || state.pending[i] != msg.Offset {
+		return kafka.Message{}, false
+	}
+
+	state.finished[msg.Offset] = struct{}{}
+
+	commit := kafka.Message{Topic: msg.Topic, Partition: msg.Partition, HighWaterMark: msg.HighWaterMark}
+	ready := false
+
+	for len(state.pending) > 0 {
+		if _, ok := state.finished[state.pending[0]]; !ok {
+			break
+		}
+
+		delete(state.finished, state.pending[0])
+		commit.Offset, ready = state.pending[0], true
+		state.pending = state.pending[1:]
+	}
+
+	return commit, ready
+}
@@ -0,0 +1,94 @@
+package consumers
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessage(partition int, offset int64) *kafka.Message {
+	return &kafka.Message{Topic: "orders", Partition: partition, Offset: offset}
+}
+
+func TestOffsetTracker_CommitsInOrder(t *testing.T) {
+	tracker := newOffsetTracker()
+
+	for offset := int64(10); offset < 13; offset++ {
+		tracker.track(newMessage(0, offset))
+	}
+
+	// Более поздние сообщения завершились раньше — коммитить нечего
+	_, ok := tracker.done(newMessage(0, 12))
+	require.False(t, ok)
+
+	_, ok = tracker.done(newMessage(0, 11))
+	require.False(t, ok)
+
+	// Завершилось первое — коммитится сразу до последнего обработанного
+	commit, ok := tracker.done(newMessage(0, 10))
+	require.True(t, ok)
+	require.Equal(t, "orders", commit.Topic)
+	require.Equal(t, int64(12), commit.Offset)
+
+	// Завершенные оффсеты не остаются в трекере
+	require.Empty(t, tracker.partitions[partitionKey{topic: "orders", partition: 0}].finished)
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tracker := newOffsetTracker()
+
+	tracker.track(newMessage(0, 1))
+	tracker.track(newMessage(1, 5))
+	tracker.track(newMessage(1, 6))
+
+	commit, ok := tracker.done(newMessage(1, 5))
+	require.True(t, ok)
+	require.Equal(t, 1, commit.Partition)
+	require.Equal(t, int64(5), commit.Offset)
+
+	commit, ok = tracker.done(newMessage(0, 1))
+	require.True(t, ok)
+	require.Equal(t, 0, commit.Partition)
+	require.Equal(t, int64(1), commit.Offset)
+}
+
+func TestOffsetTracker_ResetOnRedelivery(t *testing.T) {
+	tracker := newOffsetTracker()
+
+	tracker.track(newMessage(0, 7))
+	tracker.track(newMessage(0, 8))
+
+	// После ребалансировки партиция перечитывается с 7
+	tracker.track(newMessage(0, 7))
+
+	commit, ok := tracker.done(newMessage(0, 7))
+	require.True(t, ok)
+	require.Equal(t, int64(7), commit.Offset)
+
+	// Завершение сообщения из старого поколения ничего не коммитит
+	_, ok = tracker.done(newMessage(0, 8))
+	require.False(t, ok)
+}
+
+func TestOffsetTracker_ResetOnRebalance(t *testing.T) {
+	tracker := newOffsetTracker()
+
+	tracker.track(newMessage(0, 7))
+	tracker.track(newMessage(0, 8))
+
+	// Партиция побывала у другого инстанса и вернулась сдвинутой вперед
+	tracker.reset()
+	tracker.track(newMessage(0, 20))
+
+	// Сообщения старого поколения не коммитят ни назад, ни вперед
+	_, ok := tracker.done(newMessage(0, 8))
+	require.False(t, ok)
+
+	_, ok = tracker.done(newMessage(0, 7))
+	require.False(t, ok)
+
+	commit, ok := tracker.done(newMessage(0, 20))
+	require.True(t, ok)
+	require.Equal(t, int64(20), commit.Offset)
+}
@@ -3,16 +3,23 @@ package consumers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"orders/src/broker"
+	"orders/src/config"
+	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/db/repositories"
+	"orders/src/logger"
 	"orders/src/metrics"
 	"orders/src/service"
 	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/sethvargo/go-retry"
 	"go.opentelemetry.io/otel/sdk/trace"
-	"golang.org/x/sync/semaphore"
 )
 
 type OrderConsumer struct {
@@ -23,241 +30,380 @@ type OrderConsumer struct {
 	paymentService  service.PaymentService
 	metrics         *metrics.Metrics
 	tp              *trace.TracerProvider
+	log             *slog.Logger
+	cfg             config.Kafka
+
+	offsets  *offsetTracker
+	lag      *lagTracker
+	paused   pauseGate      // пока хранилище недоступно, новые сообщения не читаются
+	commitMu sync.Mutex     // коммиты партиции не должны обгонять друг друга
+	wg       sync.WaitGroup // цикл чтения (с воркерами) и статистика, Close ждет их завершения
 }
 
-func NewOrderConsumer(metrics *metrics.Metrics, tp *trace.TracerProvider, orderService service.OrderService,
+func NewOrderConsumer(cfg config.Kafka, metrics *metrics.Metrics, tp *trace.TracerProvider, log *slog.Logger, orderService service.OrderService,
 	deliveryService service.DeliveryService,
 	itemService service.ItemService,
 	paymentService service.PaymentService) *OrderConsumer {
 
-	broker := broker.NewBroker(tp, "orders")
+	log = logger.Component(log, "order-consumer")
 
-	return &OrderConsumer{tp: tp, broker: broker, orderService: orderService, deliveryService: deliveryService, itemService: itemService, paymentService: paymentService, metrics: metrics}
+	broker := broker.NewBroker(tp, log, cfg.Brokers, cfg.Topic, cfg.GroupID, broker.DLQTopic(cfg.Topic))
+
+	return &OrderConsumer{tp: tp, log: log, cfg: cfg, broker: broker, orderService: orderService, deliveryService: deliveryService, itemService: itemService, paymentService: paymentService, metrics: metrics, offsets: newOffsetTracker(), lag: newLagTracker(metrics)}
 }
 
-func (c *OrderConsumer) handleMessage(ctx context.Context, msg *kafka.Message) {
+// Ключи поэлементного формата, оставлены для обратной совместимости; любой другой ключ — агрегат заказа
+const (
+	keyOrder    = "order"
+	keyPayment  = "payment"
+	keyItem     = "item"
+	keyDelivery = "delivery"
+)
 
-	switch string(msg.Key) {
+// keyAggregate — метка агрегата в метриках вместо order_uid
+const keyAggregate = "aggregate"
 
-	case "order":
+func messageKind(msg *kafka.Message) string {
+	switch key := string(msg.Key); key {
+	case keyOrder, keyPayment, keyItem, keyDelivery:
+		return key
+	}
 
-		var order models.Order
+	return keyAggregate
+}
 
-		if err := json.Unmarshal(msg.Value, &order); err != nil {
-			log.Printf("ERROR IN CASE ORDER KAFKA: %v\n", err)
+var errDecode = errors.New("decode message")
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+// isTransient — такие ошибки повторяются на месте: через DLQ за время простоя сообщение исчерпало бы все ступени
+func isTransient(err error) bool {
+	return errors.Is(err, service.ErrUnavailable) || errors.Is(err, db.ErrUnavailable) || db.IsRetryable(err)
+}
 
-			if err := c.broker.PushDQL(ctx, "order", dlq, "false", "0"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+// isRepetable: неизвестные ошибки повторяются, их разберут по DLQ после исчерпания попыток
+func isRepetable(err error) bool {
+	switch {
+	case isTransient(err):
+		return true
+	case errors.Is(err, errDecode),
+		errors.Is(err, service.ErrValidation),
+		errors.Is(err, service.ErrConflict),
+		errors.Is(err, repositories.ErrConflict),
+		db.IsUniqueViolation(err),
+		db.IsCheckViolation(err):
+		return false
+	}
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+	return true
+}
 
-			return
-		}
+var errRebalanced = errors.New("partition rebalanced")
 
-		if _, err := c.orderService.CreateOrder(ctx, order); err != nil {
-			log.Printf("ERROR IN CASE ORDER SERVICE: %v\n", err)
+// handleMessage возвращает nil, только если оффсет можно коммитить
+func (c *OrderConsumer) handleMessage(ctx context.Context, msg *kafka.Message) error {
+	err := c.processUntilAvailable(ctx, msg)
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+	if err == nil {
+		c.metrics.KafkaMessagesConsumed.WithLabelValues(msg.Topic, "success").Inc()
 
-			if err := c.broker.PushDQL(ctx, "order", dlq, "true", "5"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+		return nil
+	}
+
+	if ctx.Err() != nil || errors.Is(err, errRebalanced) {
+		return err
+	}
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+	c.log.ErrorContext(ctx, "message handling failed, sending to dlq", "key", string(msg.Key), "error", err)
 
-			return
+	return c.pushDLQ(ctx, msg, err)
+}
+
+var (
+	unavailableBaseDelay = time.Second
+	unavailableMaxDelay  = 30 * time.Second
+)
 
+// processUntilAvailable на время повторов приостанавливает чтение топика
+func (c *OrderConsumer) processUntilAvailable(ctx context.Context, msg *kafka.Message) error {
+	rebalanced := c.lag.rebalanced()
+	backoff := retry.WithCappedDuration(unavailableMaxDelay, retry.NewExponential(unavailableBaseDelay))
+
+	paused := false
+
+	defer func() {
+		if paused {
+			c.paused.resume()
+		}
+	}()
+
+	for {
+		err := c.process(ctx, msg)
+		if err == nil || !isTransient(err) {
+			return err
 		}
 
-		c.metrics.KafkaMessagesConsumed.WithLabelValues(msg.Topic, "success").Inc()
+		if !paused {
+			c.paused.pause()
+			paused = true
+		}
 
-	case "payment":
+		delay, _ := backoff.Next()
+		c.log.WarnContext(ctx, "storage unavailable, retrying message in place", "delay", delay, "error", err)
 
-		var payment models.Payment
+		select {
+		case <-ctx.Done():
+			return err
+		case <-rebalanced:
+			return fmt.Errorf("%w: %v", errRebalanced, err)
+		case <-time.After(delay):
+		}
+	}
+}
 
-		if err := json.Unmarshal(msg.Value, &payment); err != nil {
-			log.Printf("ERROR IN CASE PAYMENT KAFKA: %v\n", err)
+func (c *OrderConsumer) process(ctx context.Context, msg *kafka.Message) error {
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+	switch string(msg.Key) {
 
-			if err = c.broker.PushDQL(ctx, "order", dlq, "false", "0"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+	case keyOrder:
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+		var order models.Order
 
-			return
+		if err := decode(msg, &order); err != nil {
+			return err
 		}
 
-		if _, err := c.paymentService.CreatePayment(ctx, &payment); err != nil {
-			log.Printf("ERROR IN CASE PAYMENT SERVICE: %v\n", err)
+		ctx = logger.WithAttrs(ctx, logger.OrderUID(order.OrderUID))
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+		_, err := c.orderService.CreateOrder(ctx, order)
 
-			if err = c.broker.PushDQL(ctx, "order", dlq, "true", "5"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+		return err
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+	case keyPayment:
 
-			return
+		var payment models.Payment
+
+		if err := decode(msg, &payment); err != nil {
+			return err
 		}
 
-		c.metrics.KafkaMessagesConsumed.WithLabelValues(msg.Topic, "success").Inc()
+		_, err := c.paymentService.CreatePayment(ctx, &payment)
 
-	case "item":
+		return err
+
+	case keyItem:
 
 		var item models.Item
 
-		if err := json.Unmarshal(msg.Value, &item); err != nil {
-			log.Printf("ERROR IN CASE ITEM KAFKA: %v\n", err)
+		if err := decode(msg, &item); err != nil {
+			return err
+		}
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+		_, err := c.itemService.CreateItem(ctx, &item)
 
-			if err = c.broker.PushDQL(ctx, "order", dlq, "false", "0"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+		return err
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+	case keyDelivery:
 
-			return
+		var delivery models.Delivery
+
+		if err := decode(msg, &delivery); err != nil {
+			return err
 		}
 
-		if _, err := c.itemService.CreateItem(ctx, &item); err != nil {
-			log.Printf("ERROR IN CASE ITEM SERVICE: %v\n", err)
+		_, err := c.deliveryService.CreateDelivery(ctx, &delivery)
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+		return err
 
-			if err = c.broker.PushDQL(ctx, "order", dlq, "true", "5"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
-
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+	default:
 
-			return
+		var order broker.OrderMessage
 
+		if err := decode(msg, &order); err != nil {
+			return err
 		}
 
-		c.metrics.KafkaMessagesConsumed.WithLabelValues(msg.Topic, "success").Inc()
+		ctx = logger.WithAttrs(ctx, logger.OrderUID(order.OrderUID))
 
-	case "delivery":
+		_, err := c.orderService.CreateOrderAggregate(ctx, &order)
 
-		var delivery models.Delivery
+		return err
+	}
+}
 
-		if err := json.Unmarshal(msg.Value, &delivery); err != nil {
-			log.Printf("ERROR IN CASE DELIVERY KAFKA: %v\n", err)
+func messageAttrs(msg *kafka.Message) []slog.Attr {
+	return []slog.Attr{
+		slog.String(logger.KeyTopic, msg.Topic),
+		slog.Int(logger.KeyPartition, msg.Partition),
+		slog.Int64(logger.KeyOffset, msg.Offset),
+	}
+}
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+func decode(msg *kafka.Message, v interface{}) error {
+	if err := json.Unmarshal(msg.Value, v); err != nil {
+		return fmt.Errorf("%w: %v", errDecode, err)
+	}
 
-			if err := c.broker.PushDQL(ctx, "order", dlq, "false", "0"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+	return nil
+}
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+// newDLQMessage прикладывает нарушения списком полей, чтобы разбор не требовал парсить текст ошибки
+func newDLQMessage(origin *kafka.Message, reason error) broker.DQLMessage {
+	dlq := broker.DQLMessage{
+		Origin: origin,
+		Reason: reason.Error(),
+	}
 
-			return
-		}
+	var domainErr *service.Error
+	if errors.As(reason, &domainErr) && len(domainErr.Fields) > 0 {
+		dlq.Details = domainErr.Fields
+	}
 
-		if _, err := c.deliveryService.CreateDelivery(ctx, &delivery); err != nil {
-			log.Printf("ERROR IN CASE DELIVERY SERVICE: %v\n", err)
+	return dlq
+}
 
-			dlq := broker.DQLMessage{
-				Origin: msg,
-				Reason: err.Error(),
-			}
+const (
+	dlqPushBaseDelay = time.Second
+	dlqPushMaxDelay  = 30 * time.Second
+)
 
-			if err := c.broker.PushDQL(ctx, "order", dlq, "true", "5"); err != nil {
-				log.Printf("EROR IN PushDQL: %v\n", err)
-			}
+// pushDLQ повторяет отправку до успеха: пока сообщение не в DLQ, за ним стоят коммиты всей партиции
+func (c *OrderConsumer) pushDLQ(ctx context.Context, msg *kafka.Message, reason error) error {
+	headers := broker.DLQHeaders{}
 
-			c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
-			return
+	if isRepetable(reason) {
+		headers = broker.DLQHeaders{Repetable: true, MaxRetries: c.cfg.DLQMaxRetries}
+	}
+
+	dlq := newDLQMessage(msg, reason)
+
+	backoff := retry.WithCappedDuration(dlqPushMaxDelay, retry.NewExponential(dlqPushBaseDelay))
+
+	err := retry.Do(ctx, backoff, func(ctx context.Context) error {
+		if err := c.broker.PushDQL(ctx, keyOrder, dlq, headers); err != nil {
+			c.log.ErrorContext(ctx, "push to dlq failed, retrying", "error", err)
+			return retry.RetryableError(err)
 		}
 
-		c.metrics.KafkaMessagesConsumed.WithLabelValues(msg.Topic, "success").Inc()
+		return nil
+	})
 
+	if err != nil {
+		return err
 	}
 
+	c.metrics.KafkaMessagesDLQ.WithLabelValues(msg.Topic).Inc()
+
+	return nil
+}
+
+func (c *OrderConsumer) Ping(ctx context.Context) error {
+	return c.broker.Ping(ctx)
+}
+
+func (c *OrderConsumer) commit(ctx context.Context, msg *kafka.Message) {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	ready, ok := c.offsets.done(msg)
+	if !ok {
+		return
+	}
+
+	// Коммит делается и во время остановки: сообщение уже обработано
+	if err := c.broker.Commit(context.WithoutCancel(ctx), ready); err != nil {
+		c.log.ErrorContext(ctx, "commit offset failed", "commit_offset", ready.Offset, "error", err)
+		return
+	}
+
+	c.lag.committed(ready)
 }
 
 func (c *OrderConsumer) Run(ctx context.Context) {
 
-	var wg sync.WaitGroup
+	inFlight := c.metrics.KafkaWorkersInFlight.WithLabelValues(c.broker.Topic())
+
+	workers := newDispatcher(ctx, c.cfg.Workers, c.cfg.WorkerQueue, c.cfg.ShardBy, c.cfg.BatchSize, c.cfg.BatchLinger,
+		func(ctx context.Context, batch []*kafka.Message) {
+			inFlight.Inc()
+			defer inFlight.Dec()
 
-	const maxWorkers = 20 // TODO: настроить кол-во пулов к БД
-	sem := semaphore.NewWeighted(maxWorkers)
+			c.handleBatch(ctx, batch)
+		})
+
+	c.wg.Add(2)
 
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Printf("CTX IS DONE, WAITING FOR GORUTINES...\n")
-				wg.Wait()
-				log.Printf("ALL GORUTINES IS DONE! BYE BYE\n")
-				return
+		defer c.wg.Done()
 
-			default:
-				message, err := c.broker.Read(ctx)
-				if err != nil {
-					log.Printf("error reading message: %v", err)
-					c.metrics.KafkaMessagesConsumed.WithLabelValues(message.Topic, "error").Inc()
+		watchStats(ctx, c.broker, c.metrics, c.lag, c.cfg.StatsInterval, c.log)
+	}()
 
-					continue
-				}
+	go func() {
+		defer c.wg.Done()
+		defer workers.close()
 
-				wg.Add(1)
+		rebalanced := c.lag.rebalanced()
 
-				go func(msg *kafka.Message) {
-					defer wg.Done()
+		for {
+			// Пока воркер ждет хранилище, новые сообщения упали бы так же
+			if err := c.paused.hold(ctx); err != nil {
+				c.log.Info("consumer stopping, waiting for workers")
+				return
+			}
 
-					if err := sem.Acquire(ctx, 1); err != nil {
-						log.Printf("Error sem.Acquire: %v\n", err)
-						return
-					}
+			message, err := c.broker.Fetch(ctx)
 
-					defer func() {
-						sem.Release(1)
-					}()
+			if ctx.Err() != nil {
+				c.log.Info("consumer stopping, waiting for workers")
+				return
+			}
 
-					ctx = c.broker.Trace(ctx, msg)
-					tr := c.tp.Tracer("orders-consumer")
-					_, span := tr.Start(ctx, "handle-order")
+			if err != nil {
+				c.log.ErrorContext(ctx, "fetch message failed", logger.KeyTopic, c.broker.Topic(), "error", err)
+				c.metrics.KafkaMessagesConsumed.WithLabelValues(c.broker.Topic(), "error").Inc()
 
-					c.handleMessage(ctx, msg)
+				continue
+			}
 
-					span.End()
+			select {
+			case <-rebalanced:
+				c.offsets.reset()
+				rebalanced = c.lag.rebalanced()
+			default:
+			}
 
-				}(message)
+			c.offsets.track(message)
+			c.lag.fetched(message)
 
+			// Очередь воркера заполнена — ждем: чтение не убегает вперед обработки
+			if err := workers.dispatch(ctx, message); err != nil {
+				c.log.Info("consumer stopping, waiting for workers", "error", err)
+				return
 			}
 		}
 	}()
 }
 
+func (c *OrderConsumer) handle(ctx context.Context, msg *kafka.Message) {
+	msgCtx := logger.WithAttrs(c.broker.Trace(ctx, msg), messageAttrs(msg)...)
+	tr := c.tp.Tracer("orders-consumer")
+	msgCtx, span := tr.Start(msgCtx, "handle-order")
+	defer span.End()
+
+	start := time.Now()
+	err := c.handleMessage(msgCtx, msg)
+	c.metrics.KafkaHandlerDuration.WithLabelValues(messageKind(msg)).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		c.log.WarnContext(msgCtx, "message left uncommitted", "error", err)
+		return
+	}
+
+	c.commit(msgCtx, msg)
+}
+
 func (c *OrderConsumer) Close() (error, error) {
+	c.wg.Wait()
+	c.log.Info("consumer stopped")
+
 	return c.broker.Close()
 }
@@ -0,0 +1,115 @@
+package consumers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"orders/src/broker"
+	"orders/src/db"
+	"orders/src/logger"
+	"orders/src/service"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRepetable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"decode", fmt.Errorf("%w: unexpected EOF", errDecode), false},
+		{"validation", service.NewError(service.ErrValidation, "order is invalid"), false},
+		{"conflict", service.NewError(service.ErrConflict, "order conflicts with an existing order"), false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"check violation", fmt.Errorf("insert item: %w", &pgconn.PgError{Code: "23514"}), false},
+
+		{"unavailable", service.NewError(service.ErrUnavailable, "storage is temporarily unavailable"), true},
+		{"guard rejected", fmt.Errorf("%w: circuit breaker is open", db.ErrUnavailable), true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"unknown", errors.New("boom"), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, isRepetable(c.err))
+		})
+	}
+}
+
+// unavailableOrders — сервис заказов, который отвечает ошибками errs по очереди, а затем сохраняет заказ
+type unavailableOrders struct {
+	service.OrderService
+
+	errs  []error
+	calls int
+	gate  *pauseGate
+	held  bool
+}
+
+func (s *unavailableOrders) CreateOrderAggregate(context.Context, *broker.OrderMessage) (*broker.OrderMessage, error) {
+	s.calls++
+
+	// Пока сообщение повторяется, чтение топика стоит
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	s.held = s.held || s.gate.hold(ctx) != nil
+
+	if len(s.errs) == 0 {
+		return &broker.OrderMessage{}, nil
+	}
+
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+
+	return nil, err
+}
+
+func newUnavailableConsumer(t *testing.T, errs ...error) (*OrderConsumer, *unavailableOrders) {
+	base, maxDelay := unavailableBaseDelay, unavailableMaxDelay
+	unavailableBaseDelay, unavailableMaxDelay = time.Millisecond, time.Millisecond
+
+	t.Cleanup(func() { unavailableBaseDelay, unavailableMaxDelay = base, maxDelay })
+
+	m := newLagMetrics()
+	c := &OrderConsumer{metrics: m, log: logger.Discard(), lag: newLagTracker(m)}
+	orders := &unavailableOrders{errs: errs, gate: &c.paused}
+	c.orderService = orders
+
+	return c, orders
+}
+
+func TestHandleMessage_RetriesUnavailableInPlace(t *testing.T) {
+	unavailable := service.NewError(service.ErrUnavailable, "storage is temporarily unavailable")
+	c, orders := newUnavailableConsumer(t, unavailable, fmt.Errorf("%w: circuit breaker is open", db.ErrUnavailable))
+
+	// Сообщение не уходит в DLQ: у консьюмера нет брокера, и отправка упала бы
+	msg := &kafka.Message{Topic: "orders", Key: []byte("b563feb7b2b84b6test"), Value: []byte(`{"order_uid":"b563feb7b2b84b6test"}`)}
+	require.NoError(t, c.handleMessage(context.Background(), msg))
+
+	require.Equal(t, 3, orders.calls)
+	require.True(t, orders.held)
+	require.NoError(t, c.paused.hold(context.Background()))
+}
+
+func TestHandleMessage_RebalanceStopsInPlaceRetry(t *testing.T) {
+	c, _ := newUnavailableConsumer(t, service.NewError(service.ErrUnavailable, "storage is temporarily unavailable"))
+	unavailableBaseDelay, unavailableMaxDelay = time.Minute, time.Minute
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.lag.reset()
+	}()
+
+	msg := &kafka.Message{Topic: "orders", Key: []byte("b563feb7b2b84b6test"), Value: []byte(`{"order_uid":"b563feb7b2b84b6test"}`)}
+	require.ErrorIs(t, c.handleMessage(context.Background(), msg), errRebalanced)
+	require.NoError(t, c.paused.hold(context.Background()))
+}
@@ -0,0 +1,54 @@
+package consumers
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate приостанавливает чтение, пока хоть один воркер держит паузу
+type pauseGate struct {
+	mu      sync.Mutex
+	holders int
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.holders == 0 {
+		g.resumed = make(chan struct{})
+	}
+
+	g.holders++
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.holders--
+
+	if g.holders == 0 {
+		close(g.resumed)
+	}
+}
+
+func (g *pauseGate) hold(ctx context.Context) error {
+	g.mu.Lock()
+
+	if g.holders == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
@@ -0,0 +1,269 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders/src/broker"
+	"orders/src/config"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// retryDelays — задержки ступеней; упавший повтор переходит на следующую ступень, с последней — на нее же
+var retryDelays = []time.Duration{
+	5 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+}
+
+type retryWriter interface {
+	PushRetry(ctx context.Context, topic string, key string, dlqMessage broker.DQLMessage, headers broker.DLQHeaders) error
+	PushDead(ctx context.Context, key string, dlqMessage broker.DQLMessage, headers broker.DLQHeaders) error
+}
+
+type retryTier struct {
+	broker *broker.Broker
+	delay  time.Duration
+	lag    *lagTracker
+}
+
+// RetryConsumer: у каждой задержки свой топик, поэтому порядок в топике совпадает с порядком готовности
+type RetryConsumer struct {
+	tiers    []retryTier
+	writer   retryWriter
+	process  func(ctx context.Context, msg *kafka.Message) error
+	dlqTopic string
+	metrics  *metrics.Metrics
+	tp       *trace.TracerProvider
+	log      *slog.Logger
+	cfg      config.Kafka
+
+	wg sync.WaitGroup
+}
+
+// NewRetryConsumer дает каждой ступени свою группу, чтобы ребалансировка одной не останавливала остальные
+func NewRetryConsumer(cfg config.Kafka, metrics *metrics.Metrics, tp *trace.TracerProvider, log *slog.Logger, handler *OrderConsumer) *RetryConsumer {
+	dlqTopic := broker.DLQTopic(cfg.Topic)
+
+	log = logger.Component(log, "retry-consumer")
+
+	tiers := make([]retryTier, len(retryDelays))
+
+	for i, delay := range retryDelays {
+		tiers[i] = retryTier{
+			broker: broker.NewBroker(tp, log, cfg.Brokers, broker.RetryTopic(dlqTopic, i), cfg.GroupID+"-retry-"+strconv.Itoa(i), dlqTopic),
+			delay:  delay,
+			lag:    newLagTracker(metrics),
+		}
+	}
+
+	return &RetryConsumer{
+		tiers:    tiers,
+		writer:   tiers[0].broker,
+		process:  handler.process,
+		dlqTopic: dlqTopic,
+		metrics:  metrics,
+		tp:       tp,
+		log:      log,
+		cfg:      cfg,
+	}
+}
+
+func (c *RetryConsumer) retryTopic(attempt int) string {
+	return broker.RetryTopic(c.dlqTopic, min(attempt, len(retryDelays)-1))
+}
+
+// handleMessage: недоступное хранилище попытку не тратит, ступень повторяет сообщение на месте
+func (c *RetryConsumer) handleMessage(ctx context.Context, msg *kafka.Message) error {
+	headers := broker.ParseDLQHeaders(msg.Headers)
+
+	var dlq broker.DQLMessage
+
+	if err := json.Unmarshal(msg.Value, &dlq); err != nil || dlq.Origin == nil {
+		if err == nil {
+			err = errors.New("origin is missing")
+		}
+
+		c.log.ErrorContext(ctx, "decode dlq message failed, parking", "error", err)
+
+		return c.park(ctx, msg, broker.DQLMessage{Origin: msg, Reason: fmt.Sprintf("broken dlq message: %v", err)}, headers)
+	}
+
+	ctx = logger.WithAttrs(ctx,
+		slog.String("origin_topic", dlq.Origin.Topic),
+		slog.Int("origin_partition", dlq.Origin.Partition),
+		slog.Int64("origin_offset", dlq.Origin.Offset),
+	)
+
+	if !headers.Repetable || headers.Attempt >= headers.MaxRetries {
+		return c.park(ctx, msg, dlq, headers)
+	}
+
+	headers.Attempt++
+	c.metrics.KafkaConsumerRetries.WithLabelValues(dlq.Origin.Topic).Inc()
+
+	err := c.process(ctx, dlq.Origin)
+
+	if err == nil {
+		c.metrics.KafkaMessagesConsumed.WithLabelValues(dlq.Origin.Topic, "retried").Inc()
+
+		return nil
+	}
+
+	if ctx.Err() != nil || isTransient(err) {
+		return err
+	}
+
+	c.log.WarnContext(ctx, "retry failed", "attempt", headers.Attempt, "max_retries", headers.MaxRetries, "error", err)
+
+	retry := newDLQMessage(dlq.Origin, err)
+
+	headers.Repetable = isRepetable(err)
+
+	if !headers.Repetable || headers.Attempt >= headers.MaxRetries {
+		return c.park(ctx, msg, retry, headers)
+	}
+
+	if err := c.writer.PushRetry(ctx, c.retryTopic(headers.Attempt), string(msg.Key), retry, headers); err != nil {
+		c.log.ErrorContext(ctx, "push to retry topic failed", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *RetryConsumer) park(ctx context.Context, msg *kafka.Message, dlq broker.DQLMessage, headers broker.DLQHeaders) error {
+	if err := c.writer.PushDead(ctx, string(msg.Key), dlq, headers); err != nil {
+		c.log.ErrorContext(ctx, "park message failed", "error", err)
+		return err
+	}
+
+	c.log.WarnContext(ctx, "message parked", "attempt", headers.Attempt, "reason", dlq.Reason)
+
+	c.metrics.KafkaMessagesDead.WithLabelValues(msg.Topic).Inc()
+
+	return nil
+}
+
+func (c *RetryConsumer) Run(ctx context.Context) {
+
+	for i := range c.tiers {
+		tier := &c.tiers[i]
+
+		c.wg.Add(2)
+
+		go func() {
+			defer c.wg.Done()
+
+			watchStats(ctx, tier.broker, c.metrics, tier.lag, c.cfg.StatsInterval, c.log)
+		}()
+
+		go func() {
+			defer c.wg.Done()
+
+			c.runTier(ctx, tier)
+		}()
+	}
+}
+
+func (c *RetryConsumer) runTier(ctx context.Context, tier *retryTier) {
+	for {
+		message, err := tier.broker.Fetch(ctx)
+
+		if ctx.Err() != nil {
+			c.log.Info("retry consumer stopped", logger.KeyTopic, tier.broker.Topic())
+			return
+		}
+
+		if err != nil {
+			c.log.ErrorContext(ctx, "fetch dlq message failed", logger.KeyTopic, tier.broker.Topic(), "error", err)
+			c.metrics.KafkaMessagesConsumed.WithLabelValues(tier.broker.Topic(), "error").Inc()
+
+			continue
+		}
+
+		tier.lag.fetched(message)
+
+		if !c.waitReady(ctx, tier, message) {
+			if ctx.Err() != nil {
+				c.log.Info("retry consumer stopped", logger.KeyTopic, tier.broker.Topic())
+				return
+			}
+
+			c.log.InfoContext(logger.WithAttrs(ctx, messageAttrs(message)...), "partition rebalanced while waiting, message left uncommitted")
+
+			continue
+		}
+
+		// Коммит следующего сообщения закоммитил бы и это, поэтому повторяем до успеха
+		for {
+			if err = c.retryMessage(ctx, tier, message); err == nil {
+				break
+			}
+
+			c.log.ErrorContext(logger.WithAttrs(ctx, messageAttrs(message)...), "dlq message is not handled, retrying", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+
+		if err := tier.broker.Commit(context.WithoutCancel(ctx), *message); err != nil {
+			c.log.ErrorContext(logger.WithAttrs(ctx, messageAttrs(message)...), "commit dlq offset failed", "error", err)
+			continue
+		}
+
+		tier.lag.committed(*message)
+	}
+}
+
+// waitReady прерывается ребалансировкой, чтобы не закоммитить чужую партицию
+func (c *RetryConsumer) waitReady(ctx context.Context, tier *retryTier, msg *kafka.Message) bool {
+	rebalanced := tier.lag.rebalanced()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-rebalanced:
+		return false
+	case <-time.After(time.Until(msg.Time.Add(tier.delay))):
+		return true
+	}
+}
+
+func (c *RetryConsumer) retryMessage(ctx context.Context, tier *retryTier, msg *kafka.Message) error {
+	msgCtx := logger.WithAttrs(tier.broker.Trace(ctx, msg), messageAttrs(msg)...)
+	tr := c.tp.Tracer("orders-consumer")
+	msgCtx, span := tr.Start(msgCtx, "retry-order")
+	defer span.End()
+
+	return c.handleMessage(msgCtx, msg)
+}
+
+func (c *RetryConsumer) Close() (error, error) {
+	c.wg.Wait()
+
+	var readerErrs, writerErrs []error
+
+	for _, tier := range c.tiers {
+		readerErr, writerErr := tier.broker.Close()
+
+		readerErrs = append(readerErrs, readerErr)
+		writerErrs = append(writerErrs, writerErr)
+	}
+
+	return errors.Join(readerErrs...), errors.Join(writerErrs...)
+}
@@ -0,0 +1,205 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"orders/src/broker"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"orders/src/service"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+type pushed struct {
+	topic   string
+	message broker.DQLMessage
+	headers broker.DLQHeaders
+}
+
+// fakeRetryWriter запоминает сообщения, отправленные на повтор и в терминальный топик
+type fakeRetryWriter struct {
+	retried []pushed
+	dead    []pushed
+}
+
+func (w *fakeRetryWriter) PushRetry(_ context.Context, topic string, _ string, dlqMessage broker.DQLMessage, headers broker.DLQHeaders) error {
+	w.retried = append(w.retried, pushed{topic: topic, message: dlqMessage, headers: headers})
+	return nil
+}
+
+func (w *fakeRetryWriter) PushDead(_ context.Context, _ string, dlqMessage broker.DQLMessage, headers broker.DLQHeaders) error {
+	w.dead = append(w.dead, pushed{topic: broker.DeadTopic("orders.errors"), message: dlqMessage, headers: headers})
+	return nil
+}
+
+func newTestRetryConsumer(process func(ctx context.Context, msg *kafka.Message) error) (*RetryConsumer, *fakeRetryWriter) {
+	writer := &fakeRetryWriter{}
+
+	m := &metrics.Metrics{
+		KafkaMessagesConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_kafka_messages_consumed_total"}, []string{"topic", "status"}),
+		KafkaConsumerRetries:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_kafka_consumer_retries_total"}, []string{"topic"}),
+		KafkaMessagesDead:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_kafka_messages_dead_total"}, []string{"topic"}),
+	}
+
+	return &RetryConsumer{
+		writer:   writer,
+		process:  process,
+		dlqTopic: "orders.errors",
+		metrics:  m,
+		tp:       trace.NewTracerProvider(),
+		log:      logger.Discard(),
+	}, writer
+}
+
+// newDLQRecord — сообщение ступени повторов с исходным сообщением топика orders
+func newDLQRecord(t *testing.T, topic string, headers broker.DLQHeaders) *kafka.Message {
+	value, err := json.Marshal(broker.DQLMessage{
+		Origin: &kafka.Message{Topic: "orders", Offset: 42, Value: []byte(`{"order_uid":"b563feb7b2b84b6test"}`)},
+		Reason: "storage is temporarily unavailable",
+	})
+	require.NoError(t, err)
+
+	return &kafka.Message{
+		Topic: topic,
+		Key:   []byte(keyOrder),
+		Value: value,
+		Time:  time.Now().Add(-time.Hour),
+		Headers: []kafka.Header{
+			{Key: broker.HeaderRepetable, Value: []byte(strconv.FormatBool(headers.Repetable))},
+			{Key: broker.HeaderMaxRetries, Value: []byte(strconv.Itoa(headers.MaxRetries))},
+			{Key: broker.HeaderAttempt, Value: []byte(strconv.Itoa(headers.Attempt))},
+		},
+	}
+}
+
+func TestRetryConsumer_RetriesSuccessfully(t *testing.T) {
+	var origin *kafka.Message
+
+	c, writer := newTestRetryConsumer(func(_ context.Context, msg *kafka.Message) error {
+		origin = msg
+		return nil
+	})
+
+	msg := newDLQRecord(t, "orders.errors", broker.DLQHeaders{Repetable: true, MaxRetries: 5})
+	require.NoError(t, c.handleMessage(context.Background(), msg))
+
+	require.Equal(t, int64(42), origin.Offset)
+	require.Empty(t, writer.retried)
+	require.Empty(t, writer.dead)
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.KafkaConsumerRetries.WithLabelValues("orders")))
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.KafkaMessagesConsumed.WithLabelValues("orders", "retried")))
+}
+
+func TestRetryConsumer_FailedRetryMovesToNextTier(t *testing.T) {
+	c, writer := newTestRetryConsumer(func(_ context.Context, _ *kafka.Message) error {
+		return errors.New("boom")
+	})
+
+	msg := newDLQRecord(t, "orders.errors.1", broker.DLQHeaders{Repetable: true, MaxRetries: 5, Attempt: 1})
+	require.NoError(t, c.handleMessage(context.Background(), msg))
+
+	require.Empty(t, writer.dead)
+	require.Len(t, writer.retried, 1)
+	require.Equal(t, "orders.errors.2", writer.retried[0].topic)
+	require.Equal(t, broker.DLQHeaders{Repetable: true, MaxRetries: 5, Attempt: 2}, writer.retried[0].headers)
+	require.Equal(t, int64(42), writer.retried[0].message.Origin.Offset)
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.KafkaConsumerRetries.WithLabelValues("orders")))
+}
+
+func TestRetryConsumer_UnavailableKeepsAttempt(t *testing.T) {
+	c, writer := newTestRetryConsumer(func(_ context.Context, _ *kafka.Message) error {
+		return service.NewError(service.ErrUnavailable, "storage is temporarily unavailable")
+	})
+
+	// Последняя попытка во время простоя хранилища: сообщение не паркуется, ступень повторит его
+	msg := newDLQRecord(t, "orders.errors.1", broker.DLQHeaders{Repetable: true, MaxRetries: 2, Attempt: 1})
+	require.ErrorIs(t, c.handleMessage(context.Background(), msg), service.ErrUnavailable)
+
+	require.Empty(t, writer.retried)
+	require.Empty(t, writer.dead)
+}
+
+func TestRetryConsumer_ParksExhaustedAndNotRepetable(t *testing.T) {
+	cases := []struct {
+		name        string
+		headers     broker.DLQHeaders
+		processErr  error
+		wantAttempt int
+		wantRetries float64
+	}{
+		{"not repetable", broker.DLQHeaders{MaxRetries: 5}, nil, 0, 0},
+		{"attempts exhausted", broker.DLQHeaders{Repetable: true, MaxRetries: 2, Attempt: 2}, nil, 2, 0},
+		{"last retry failed", broker.DLQHeaders{Repetable: true, MaxRetries: 2, Attempt: 1}, errors.New("boom"), 2, 1},
+		{"retry is not repetable", broker.DLQHeaders{Repetable: true, MaxRetries: 5},
+			service.NewError(service.ErrValidation, "order is invalid"), 1, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, writer := newTestRetryConsumer(func(_ context.Context, _ *kafka.Message) error { return tc.processErr })
+
+			msg := newDLQRecord(t, "orders.errors", tc.headers)
+			require.NoError(t, c.handleMessage(context.Background(), msg))
+
+			require.Empty(t, writer.retried)
+			require.Len(t, writer.dead, 1)
+			require.Equal(t, tc.wantAttempt, writer.dead[0].headers.Attempt)
+			require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.KafkaMessagesDead.WithLabelValues("orders.errors")))
+			require.Equal(t, tc.wantRetries, testutil.ToFloat64(c.metrics.KafkaConsumerRetries.WithLabelValues("orders")))
+		})
+	}
+}
+
+func TestRetryConsumer_ParksBrokenMessage(t *testing.T) {
+	c, writer := newTestRetryConsumer(func(_ context.Context, _ *kafka.Message) error {
+		t.Fatal("broken message must not be processed")
+		return nil
+	})
+
+	msg := &kafka.Message{Topic: "orders.errors", Value: []byte(`{`)}
+	require.NoError(t, c.handleMessage(context.Background(), msg))
+
+	require.Len(t, writer.dead, 1)
+	require.Contains(t, writer.dead[0].message.Reason, "broken dlq message")
+}
+
+func TestRetryConsumer_WaitReady(t *testing.T) {
+	c, _ := newTestRetryConsumer(nil)
+	tier := &retryTier{delay: time.Minute, lag: newLagTracker(newLagMetrics())}
+
+	msg := newDLQRecord(t, "orders.errors", broker.DLQHeaders{Repetable: true, MaxRetries: 5})
+	require.True(t, c.waitReady(context.Background(), tier, msg))
+
+	// Сообщение еще не готово: ожидание прерывает ребалансировка, чтобы не коммитить чужую партицию
+	msg.Time = time.Now()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		tier.lag.reset()
+	}()
+
+	require.False(t, c.waitReady(context.Background(), tier, msg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	require.False(t, c.waitReady(ctx, tier, msg))
+}
+
+func TestRetryTopic(t *testing.T) {
+	c, _ := newTestRetryConsumer(nil)
+
+	require.Equal(t, "orders.errors", c.retryTopic(0))
+	require.Equal(t, "orders.errors.1", c.retryTopic(1))
+	// Попытки сверх числа ступеней ждут на последней
+	require.Equal(t, "orders.errors.4", c.retryTopic(len(retryDelays)+3))
+}
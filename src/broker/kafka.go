@@ -3,12 +3,12 @@ package broker
 import (
 	"context"
 	"encoding/json"
-	"log"
-	"os"
+	"fmt"
+	"log/slog"
+	"strconv"
 
 	otelkafkakonsumer "github.com/Trendyol/otel-kafka-konsumer"
 	"github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/protocol"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -16,20 +16,22 @@ import (
 )
 
 type Broker struct {
-	topic  string
-	reader *otelkafkakonsumer.Reader
-	writer *kafka.Writer
+	brokers  []string
+	topic    string
+	dlqTopic string
+	reader   *otelkafkakonsumer.Reader
+	writer   *kafka.Writer
 }
 
-func NewBroker(tp *trace.TracerProvider, topic string) *Broker {
-
-	kafkaUrls := []string{os.Getenv("KAFKA_HOST")}
+// NewBroker создает reader топика topic в группе groupID и writer для DLQ-топика dlqTopic.
+// Терминальный топик для сообщений, исчерпавших попытки, — DeadTopic(dlqTopic)
+func NewBroker(tp *trace.TracerProvider, log *slog.Logger, kafkaUrls []string, topic string, groupID string, dlqTopic string) *Broker {
 
 	r, err := otelkafkakonsumer.NewReader(
 		kafka.NewReader(kafka.ReaderConfig{
 			Brokers: kafkaUrls,
 			Topic:   topic,
-			GroupID: "GroupID",
+			GroupID: groupID,
 		}),
 		otelkafkakonsumer.WithTracerProvider(tp),
 		otelkafkakonsumer.WithPropagator(propagation.TraceContext{}),
@@ -42,41 +44,123 @@ func NewBroker(tp *trace.TracerProvider, topic string) *Broker {
 	)
 
 	if err != nil {
-		log.Printf("ERROR IN INIT READER: %v\n", err)
+		log.Error("init kafka reader failed", "topic", topic, "error", err)
+	}
+
+	// Топик задается в каждом сообщении: writer пишет и в DLQ, и в терминальный топик
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(kafkaUrls...),
+		AllowAutoTopicCreation: true,
+	}
+
+	return &Broker{brokers: kafkaUrls, topic: topic, dlqTopic: dlqTopic, reader: r, writer: w}
+}
+
+// DLQTopic возвращает имя DLQ-топика для топика topic
+func DLQTopic(topic string) string {
+	return topic + ".errors"
+}
+
+// RetryTopic возвращает имя топика ступени повторов tier для DLQ-топика dlqTopic. Нулевая ступень — сам DLQ-топик,
+// в него пишет основной консьюмер; повторы, которые снова упали, переходят на следующие ступени
+func RetryTopic(dlqTopic string, tier int) string {
+	if tier == 0 {
+		return dlqTopic
+	}
+
+	return dlqTopic + "." + strconv.Itoa(tier)
+}
+
+// DeadTopic возвращает имя терминального топика для DLQ-топика dlqTopic
+func DeadTopic(dlqTopic string) string {
+	return dlqTopic + ".dead"
+}
+
+func (b *Broker) Topic() string {
+	return b.topic
+}
+
+// Stats возвращает статистику reader с прошлого вызова: счетчики при чтении сбрасываются
+func (b *Broker) Stats() kafka.ReaderStats {
+	return b.reader.R.Stats()
+}
+
+// HighWaterMarks возвращает high watermark партиций partitions топика reader
+func (b *Broker) HighWaterMarks(ctx context.Context, partitions []int) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+
+	for _, partition := range partitions {
+		requests = append(requests, kafka.LastOffsetOf(partition))
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(b.brokers...)}
+
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{b.topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+
+	marks := make(map[int]int64, len(partitions))
+
+	for _, offsets := range resp.Topics[b.topic] {
+		if offsets.Error != nil {
+			return nil, fmt.Errorf("partition %d: %w", offsets.Partition, offsets.Error)
+		}
+
+		marks[offsets.Partition] = offsets.LastOffset
 	}
 
-	DLQTopic := topic + "." + "errors"
+	return marks, nil
+}
+
+// Fetch читает следующее сообщение без коммита оффсета: коммит делает вызывающий через Commit,
+// когда сообщение обработано или отправлено в DLQ
+func (b *Broker) Fetch(ctx context.Context) (*kafka.Message, error) {
+	var message kafka.Message
+
+	if err := b.reader.FetchMessage(ctx, &message); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+func (b *Broker) Commit(ctx context.Context, messages ...kafka.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
 
-	w := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: kafkaUrls,
-		Topic:   DLQTopic,
-	})
+	return b.reader.CommitMessages(ctx, messages...)
+}
 
-	w.AllowAutoTopicCreation = true
+// PushDQL отправляет сообщение в DLQ-топик для повторной обработки
+func (b *Broker) PushDQL(ctx context.Context, key string, dlqMessage DQLMessage, headers DLQHeaders) error {
+	return b.push(ctx, b.dlqTopic, key, dlqMessage, headers)
+}
 
-	return &Broker{topic: topic, reader: r, writer: w}
+// PushRetry отправляет сообщение в топик ступени повторов (RetryTopic)
+func (b *Broker) PushRetry(ctx context.Context, topic string, key string, dlqMessage DQLMessage, headers DLQHeaders) error {
+	return b.push(ctx, topic, key, dlqMessage, headers)
 }
 
-func (b *Broker) Read(ctx context.Context) (*kafka.Message, error) {
-	return b.reader.ReadMessage(ctx)
+// PushDead паркует сообщение в терминальном топике, откуда оно уже не перечитывается
+func (b *Broker) PushDead(ctx context.Context, key string, dlqMessage DQLMessage, headers DLQHeaders) error {
+	return b.push(ctx, DeadTopic(b.dlqTopic), key, dlqMessage, headers)
 }
 
-func (b *Broker) PushDQL(ctx context.Context, key string, dlqMessage DQLMessage, repetable string, maxRetries string) error {
+func (b *Broker) push(ctx context.Context, topic string, key string, dlqMessage DQLMessage, headers DLQHeaders) error {
 
 	dlqMessageJSON, err := json.Marshal(dlqMessage)
 
 	if err != nil {
-		log.Printf("ERROR IN dlqMessageJSON: %v\n", err)
-		return err
+		return fmt.Errorf("encode dlq message: %w", err)
 	}
 
 	message := kafka.Message{
-		Key:   []byte(key),
-		Value: dlqMessageJSON,
-		Headers: []kafka.Header{
-			protocol.Header{Key: "repetable", Value: []byte(repetable)},
-			protocol.Header{Key: "max_retries", Value: []byte(maxRetries)},
-		},
+		Topic:   topic,
+		Key:     []byte(key),
+		Value:   dlqMessageJSON,
+		Headers: headers.toKafka(),
 	}
 
 	return b.writer.WriteMessages(ctx, message)
@@ -88,6 +172,45 @@ func (b *Broker) Trace(ctx context.Context, message *kafka.Message) context.Cont
 	return ctx
 }
 
+// Ping проверяет, что reader может читать топик: кластер отвечает, топик есть и у всех его партиций есть лидер
+func (b *Broker) Ping(ctx context.Context) error {
+	return ping(ctx, b.brokers, b.topic)
+}
+
+// ping запрашивает метаданные topic. Одного подключения к брокеру мало: без лидера партиции чтение и запись стоят
+func ping(ctx context.Context, brokers []string, topic string) error {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+
+	res, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range res.Topics {
+		if t.Name != topic {
+			continue
+		}
+
+		if t.Error != nil {
+			return fmt.Errorf("topic %s: %w", topic, t.Error)
+		}
+
+		if len(t.Partitions) == 0 {
+			return fmt.Errorf("topic %s has no partitions", topic)
+		}
+
+		for _, p := range t.Partitions {
+			if p.Error != nil {
+				return fmt.Errorf("topic %s partition %d: %w", topic, p.ID, p.Error)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("topic %s not found", topic)
+}
+
 func (b *Broker) Close() (error, error) {
 	readerError := b.reader.Close()
 	writerError := b.writer.Close()
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	otelkafkakonsumer "github.com/Trendyol/otel-kafka-konsumer"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Producer публикует доменные события в топик topic. Сообщения с одним ключом попадают в одну партицию
+type Producer struct {
+	brokers []string
+	topic   string
+	writer  *kafka.Writer
+	prop    propagation.TextMapPropagator
+}
+
+// producerBatchTimeout — сколько writer ждет заполнения пачки партиции. Publish синхронный и получает
+// уже собранную пачку реле, поэтому ждать дописывания нечего: по умолчанию kafka-go ждет секунду
+const producerBatchTimeout = 10 * time.Millisecond
+
+// NewProducer создает producer; batchSize — сколько сообщений Publish пишет за раз
+func NewProducer(kafkaUrls []string, topic string, batchSize int) *Producer {
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(kafkaUrls...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		BatchSize:              batchSize,
+		BatchTimeout:           producerBatchTimeout,
+		AllowAutoTopicCreation: true,
+	}
+
+	return &Producer{brokers: kafkaUrls, topic: topic, writer: w, prop: propagation.TraceContext{}}
+}
+
+func (p *Producer) Topic() string {
+	return p.topic
+}
+
+// Inject кладет контекст трассировки ctx в заголовки сообщения — Broker.Trace извлекает его тем же пропагатором
+func (p *Producer) Inject(ctx context.Context, message *kafka.Message) {
+	p.prop.Inject(ctx, otelkafkakonsumer.NewMessageCarrier(message))
+}
+
+// Publish синхронно пишет сообщения и возвращает ошибку, если хоть одно не подтверждено брокером
+func (p *Producer) Publish(ctx context.Context, messages ...kafka.Message) error {
+	return p.writer.WriteMessages(ctx, messages...)
+}
+
+func (p *Producer) Ping(ctx context.Context) error {
+	return ping(ctx, p.brokers, p.topic)
+}
+
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
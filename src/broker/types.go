@@ -2,19 +2,89 @@ package broker
 
 import (
 	"orders/src/db/models"
+	"strconv"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// OrderMessage — агрегат заказа (каноническая модель WB): заказ с вложенными доставкой, оплатой и товарами
 type OrderMessage struct {
 	models.Order
 
 	Delivery models.Delivery `json:"delivery"`
 	Payment  models.Payment  `json:"payment"`
-	Items    []models.Item   `json:"items"`
+	Items    []models.Item   `json:"items" validate:"required,min=1,dive"`
 }
 
 type DQLMessage struct {
 	Origin *kafka.Message `json:"origin"`
 	Reason string         `json:"reason"`
+	// Details — структурированная причина, например список нарушенных правил валидации
+	Details any `json:"details,omitempty"`
+}
+
+// Заголовки сообщений DLQ
+const (
+	HeaderRepetable  = "repetable"
+	HeaderMaxRetries = "max_retries"
+	HeaderAttempt    = "attempt"
+)
+
+// DLQHeaders — политика повторов сообщения DLQ: можно ли его повторять,
+// сколько всего попыток разрешено и сколько уже сделано
+type DLQHeaders struct {
+	Repetable  bool
+	MaxRetries int
+	Attempt    int
+}
+
+// ParseDLQHeaders читает политику повторов из заголовков; отсутствующие или битые значения считаются нулевыми
+func ParseDLQHeaders(headers []kafka.Header) DLQHeaders {
+	var h DLQHeaders
+
+	for _, header := range headers {
+		value := string(header.Value)
+
+		switch header.Key {
+		case HeaderRepetable:
+			h.Repetable, _ = strconv.ParseBool(value)
+		case HeaderMaxRetries:
+			h.MaxRetries, _ = strconv.Atoi(value)
+		case HeaderAttempt:
+			h.Attempt, _ = strconv.Atoi(value)
+		}
+	}
+
+	return h
+}
+
+func (h DLQHeaders) toKafka() []kafka.Header {
+	return []kafka.Header{
+		{Key: HeaderRepetable, Value: []byte(strconv.FormatBool(h.Repetable))},
+		{Key: HeaderMaxRetries, Value: []byte(strconv.Itoa(h.MaxRetries))},
+		{Key: HeaderAttempt, Value: []byte(strconv.Itoa(h.Attempt))},
+	}
+}
+
+// Типы доменных событий заказа, публикуемых через outbox
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// Заголовки сообщений с доменными событиями
+const (
+	HeaderEventID   = "event_id"
+	HeaderEventType = "event_type"
+)
+
+// OrderEvent — доменное событие заказа. Ключ сообщения — order_uid, поэтому события одного заказа
+// попадают в одну партицию и читаются по порядку. Доставка at-least-once: дубли отсекаются по заголовку event_id
+type OrderEvent struct {
+	Type       string    `json:"type"`
+	OrderID    int       `json:"order_id"`
+	OrderUID   string    `json:"order_uid"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
 }
@@ -0,0 +1,166 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State — состояние автомата. Значения совпадают со значениями метрики circuit_breaker_state
+type State int
+
+const (
+	Closed   State = iota // вызовы проходят, считаются подряд идущие ошибки
+	HalfOpen              // пропускается один пробный вызов
+	Open                  // вызовы отклоняются до истечения OpenTimeout
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrOpen — вызов отклонен: автомат открыт или пробный вызов уже выполняется
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Settings struct {
+	Name string
+	// FailureThreshold — сколько ошибок подряд открывают автомат
+	FailureThreshold int
+	// OpenTimeout — сколько автомат остается открытым, прежде чем пропустить пробный вызов
+	OpenTimeout time.Duration
+	// OnStateChange вызывается при каждой смене состояния под блокировкой автомата, поэтому должен быть быстрым
+	OnStateChange func(name string, from, to State)
+}
+
+// Breaker — автомат closed -> open -> half-open -> closed/open. Безопасен для конкурентного использования
+type Breaker struct {
+	settings Settings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool // в half-open пробный вызов уже выдан
+	// generation растет при каждой смене состояния. Вызов помнит поколение, в котором начался,
+	// и его результат учитывается, только если состояние с тех пор не менялось
+	generation uint64
+}
+
+func New(settings Settings) *Breaker {
+	return &Breaker{settings: settings, now: time.Now}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Allow решает, можно ли выполнить вызов. Если можно, вызывающий обязан сообщить результат через done
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.settings.OpenTimeout {
+			return nil, ErrOpen
+		}
+
+		b.setState(HalfOpen)
+		b.trial = true
+	case HalfOpen:
+		if b.trial {
+			return nil, ErrOpen
+		}
+
+		b.trial = true
+	}
+
+	generation := b.generation
+
+	return func(success bool) { b.done(generation, success) }, nil
+}
+
+// Execute выполняет fn, если автомат пропускает вызов. isFailure решает, какие ошибки fn считать отказом
+// зависимости: например, промах кеша или отмена запроса клиентом автомат не открывают.
+// Паника fn считается отказом и пробрасывается дальше: место пробы в half-open освобождается в любом случае
+func (b *Breaker) Execute(fn func() error, isFailure func(error) bool) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	success := false
+	defer func() { done(success) }()
+
+	err = fn()
+	success = err == nil || !isFailure(err)
+
+	return err
+}
+
+func (b *Breaker) done(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Вызов начат до смены состояния: например, начатый в closed не должен засчитываться как пробный в half-open
+	if generation != b.generation {
+		return
+	}
+
+	if b.state == HalfOpen {
+		b.trial = false
+
+		if success {
+			b.failures = 0
+			b.setState(Closed)
+		} else {
+			b.open()
+		}
+
+		return
+	}
+
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.settings.FailureThreshold {
+		b.open()
+	}
+}
+
+func (b *Breaker) open() {
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+
+	from := b.state
+	b.state = state
+	b.generation++
+
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.settings.Name, from, state)
+	}
+}
@@ -0,0 +1,147 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("connection refused")
+
+func always(error) bool { return true }
+
+func newTestBreaker() (*Breaker, *time.Time, *[]State) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var changes []State
+
+	b := New(Settings{
+		Name:             "test",
+		FailureThreshold: 3,
+		OpenTimeout:      10 * time.Second,
+		OnStateChange:    func(_ string, _, to State) { changes = append(changes, to) },
+	})
+	b.now = func() time.Time { return now }
+
+	return b, &now, &changes
+}
+
+func TestBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b, _, _ := newTestBreaker()
+
+	fail := func() error { return errDown }
+	ok := func() error { return nil }
+
+	require.ErrorIs(t, b.Execute(fail, always), errDown)
+	require.ErrorIs(t, b.Execute(fail, always), errDown)
+
+	// Успех сбрасывает счетчик: нужны ошибки подряд
+	require.NoError(t, b.Execute(ok, always))
+	require.Equal(t, Closed, b.State())
+
+	for range 3 {
+		require.ErrorIs(t, b.Execute(fail, always), errDown)
+	}
+
+	require.Equal(t, Open, b.State())
+	require.ErrorIs(t, b.Execute(ok, always), ErrOpen)
+}
+
+func TestBreaker_IgnoresNonFailures(t *testing.T) {
+	b, _, _ := newTestBreaker()
+
+	miss := errors.New("cache miss")
+	isFailure := func(err error) bool { return !errors.Is(err, miss) }
+
+	for range 5 {
+		require.ErrorIs(t, b.Execute(func() error { return miss }, isFailure), miss)
+	}
+
+	require.Equal(t, Closed, b.State())
+}
+
+func TestBreaker_HalfOpenTrial(t *testing.T) {
+	b, now, changes := newTestBreaker()
+
+	for range 3 {
+		_ = b.Execute(func() error { return errDown }, always)
+	}
+
+	*now = now.Add(10 * time.Second)
+
+	// Первый вызов после таймаута — пробный, остальные отклоняются, пока он идет
+	done, err := b.Allow()
+	require.NoError(t, err)
+	require.Equal(t, HalfOpen, b.State())
+
+	_, err = b.Allow()
+	require.ErrorIs(t, err, ErrOpen)
+
+	// Проба не удалась — снова открыт на полный таймаут
+	done(false)
+	require.Equal(t, Open, b.State())
+
+	_, err = b.Allow()
+	require.ErrorIs(t, err, ErrOpen)
+
+	*now = now.Add(10 * time.Second)
+
+	done, err = b.Allow()
+	require.NoError(t, err)
+
+	done(true)
+	require.Equal(t, Closed, b.State())
+
+	require.Equal(t, []State{Open, HalfOpen, Open, HalfOpen, Closed}, *changes)
+}
+
+func TestBreaker_IgnoresResultsFromPreviousState(t *testing.T) {
+	b, now, _ := newTestBreaker()
+
+	// Вызов начат, пока автомат закрыт, и завис
+	slow, err := b.Allow()
+	require.NoError(t, err)
+
+	for range 3 {
+		_ = b.Execute(func() error { return errDown }, always)
+	}
+
+	*now = now.Add(10 * time.Second)
+
+	trial, err := b.Allow()
+	require.NoError(t, err)
+	require.Equal(t, HalfOpen, b.State())
+
+	// Поздний успех старого вызова не закрывает автомат и не освобождает место пробы
+	slow(true)
+	require.Equal(t, HalfOpen, b.State())
+
+	_, err = b.Allow()
+	require.ErrorIs(t, err, ErrOpen)
+
+	trial(false)
+	require.Equal(t, Open, b.State())
+}
+
+func TestBreaker_PanicReleasesTrial(t *testing.T) {
+	b, now, _ := newTestBreaker()
+
+	for range 3 {
+		_ = b.Execute(func() error { return errDown }, always)
+	}
+
+	*now = now.Add(10 * time.Second)
+
+	require.Panics(t, func() {
+		_ = b.Execute(func() error { panic("boom") }, always)
+	})
+
+	// Паника пробного вызова — отказ: автомат снова открыт, а не завис в half-open с занятым местом пробы
+	require.Equal(t, Open, b.State())
+
+	*now = now.Add(10 * time.Second)
+
+	require.NoError(t, b.Execute(func() error { return nil }, always))
+	require.Equal(t, Closed, b.State())
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config — настройки сервиса. Значения по умолчанию задает Default, поверх читается YAML-файл,
+// а затем переменные окружения из тегов env
+type Config struct {
+	HTTP     HTTP   `yaml:"http"`
+	DB       DB     `yaml:"db"`
+	Kafka    Kafka  `yaml:"kafka"`
+	Redis    Redis  `yaml:"redis"`
+	Tracer   Tracer `yaml:"tracer"`
+	Log      Log    `yaml:"log"`
+	WarmUp   WarmUp `yaml:"warmup"`
+	Health   Health `yaml:"health"`
+	Outbox   Outbox `yaml:"outbox"`
+	FillData bool   `yaml:"fill_data" env:"FILL_DATA"` // писать тестовые заказы в Kafka при старте
+}
+
+type HTTP struct {
+	Port              int           `yaml:"port" env:"HTTP_PORT" validate:"min=1,max=65535"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" validate:"gt=0"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" validate:"gte=0"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" validate:"gte=0"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" validate:"gte=0"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" validate:"gt=0"`
+	// Tokens — bearer-токены для изменяющих маршрутов в виде name:token; name записывается автором изменения.
+	// Без токенов такие маршруты всегда отвечают 401
+	Tokens []string `yaml:"tokens" env:"HTTP_TOKENS" validate:"dive,credential" secret:"true"`
+}
+
+type DB struct {
+	URL             string        `yaml:"url" env:"DATABASE_URL" validate:"required,url" secret:"true"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" validate:"min=1"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" validate:"min=0,ltefield=MaxOpenConns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" validate:"gte=0"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" validate:"gte=0"`
+	// Migrate — что делать со встроенными миграциями при старте: auto — применить, verify — только проверить, off — ничего
+	Migrate string `yaml:"migrate" env:"DB_MIGRATE" validate:"oneof=auto verify off"`
+	// Защита репозиториев: автомат, ожидание свободного соединения не дольше AcquireTimeout и бюджет повторов
+	Breaker        Breaker       `yaml:"breaker"`
+	AcquireTimeout time.Duration `yaml:"acquire_timeout" validate:"gt=0"`
+	Retry          Retry         `yaml:"retry"`
+}
+
+// Retry — повторы запросов с экспоненциальной задержкой от BaseDelay до MaxDelay. Бюджет ограничивает долю повторов:
+// каждый запрос добавляет BudgetRatio токена (не больше BudgetBurst), каждый повтор тратит один
+type Retry struct {
+	MaxRetries  int           `yaml:"max_retries" validate:"min=0"`
+	BaseDelay   time.Duration `yaml:"base_delay" validate:"gt=0"`
+	MaxDelay    time.Duration `yaml:"max_delay" validate:"gtefield=BaseDelay"`
+	BudgetRatio float64       `yaml:"budget_ratio" validate:"gte=0,lte=1"`
+	BudgetBurst int           `yaml:"budget_burst" validate:"min=0"`
+}
+
+type Kafka struct {
+	Brokers []string `yaml:"brokers" env:"KAFKA_HOST" validate:"required,min=1,dive,hostname_port"`
+	Topic   string   `yaml:"topic" env:"KAFKA_TOPIC" validate:"required"`
+	GroupID string   `yaml:"group_id" env:"KAFKA_GROUP_ID" validate:"required"`
+	// Workers — сколько сообщений обрабатывается параллельно; не стоит делать больше пула соединений БД
+	Workers int `yaml:"workers" env:"KAFKA_WORKERS" validate:"min=1,max=1000"`
+	// ShardBy — как сообщения раскладываются по воркерам: key — агрегаты по заказу (order_uid), порядок сохраняется
+	// внутри заказа, поэлементные сообщения — по партиции; partition — все по партиции, порядок сохраняется внутри
+	// партиции. WorkerQueue — очередь каждого воркера
+	ShardBy     string `yaml:"shard_by" env:"KAFKA_SHARD_BY" validate:"oneof=key partition"`
+	WorkerQueue int    `yaml:"worker_queue" validate:"min=0"`
+	// BatchSize — сколько агрегатов воркер собирает в пачку и сохраняет одной транзакцией; 1 — по одному сообщению.
+	// BatchLinger — сколько воркер ждет заполнения пачки, прежде чем сохранить неполную
+	BatchSize   int           `yaml:"batch_size" env:"KAFKA_BATCH_SIZE" validate:"min=1,max=1000"`
+	BatchLinger time.Duration `yaml:"batch_linger" validate:"gt=0"`
+	// DLQMaxRetries — сколько раз обработчик DLQ повторяет сообщение, прежде чем запарковать его
+	DLQMaxRetries int `yaml:"dlq_max_retries" validate:"min=0"`
+	// StatsInterval — как часто статистика reader (задержка чтения, ребалансировки) переносится в метрики
+	StatsInterval time.Duration `yaml:"stats_interval" validate:"gt=0"`
+}
+
+type Redis struct {
+	Host        string        `yaml:"host" env:"REDIS_HOST" validate:"required"`
+	Port        int           `yaml:"port" env:"REDIS_PORT" validate:"min=1,max=65535"`
+	User        string        `yaml:"user"`
+	Password    string        `yaml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB          int           `yaml:"db" validate:"min=0"`
+	MaxRetries  int           `yaml:"max_retries" validate:"min=-1"`
+	DialTimeout time.Duration `yaml:"dial_timeout" validate:"gte=0"`
+	Timeout     time.Duration `yaml:"timeout" validate:"gte=0"`
+	TTL         time.Duration `yaml:"ttl" validate:"gt=0"`
+	// LocalSize и LocalTTL — размер и время жизни локального TinyLFU-кеша перед Redis
+	LocalSize int           `yaml:"local_size" validate:"min=1"`
+	LocalTTL  time.Duration `yaml:"local_ttl" validate:"gt=0"`
+	// InvalidationChannel — канал pub/sub, через который инстансы сбрасывают друг у друга локальные копии
+	InvalidationChannel string `yaml:"invalidation_channel" validate:"required"`
+	// Breaker — автомат перед Redis; пока он открыт, раз в ProbeInterval Redis проверяется пингом
+	Breaker       Breaker       `yaml:"breaker"`
+	ProbeInterval time.Duration `yaml:"probe_interval" validate:"gt=0"`
+}
+
+// Breaker — настройки автомата: FailureThreshold ошибок подряд открывают его на OpenTimeout
+type Breaker struct {
+	FailureThreshold int           `yaml:"failure_threshold" validate:"min=1"`
+	OpenTimeout      time.Duration `yaml:"open_timeout" validate:"gt=0"`
+}
+
+// Tracer — экспорт трейсов. Exporter: otlp-grpc и otlp-http отправляют на Endpoint (host:port), stdout пишет спаны
+// в File (пусто — в stdout), none и OTLP без Endpoint только создают спаны для trace_id в логах и ответах.
+// SampleRatio — доля новых трейсов; решение родительского спана соблюдается
+type Tracer struct {
+	Exporter    string  `yaml:"exporter" env:"TRACER_EXPORTER" validate:"oneof=otlp-grpc otlp-http stdout none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACER_ENDPOINT" validate:"omitempty,hostname_port"`
+	Insecure    bool    `yaml:"insecure" env:"TRACER_INSECURE"`
+	File        string  `yaml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACER_SAMPLE_RATIO" validate:"gte=0,lte=1"`
+
+	// Атрибуты ресурса: service.name, service.version, deployment.environment.name, service.instance.id.
+	// Пустой Instance — имя хоста
+	ServiceName string `yaml:"service_name" validate:"required"`
+	Version     string `yaml:"version" env:"SERVICE_VERSION"`
+	Environment string `yaml:"environment" env:"DEPLOY_ENVIRONMENT"`
+	Instance    string `yaml:"instance" env:"SERVICE_INSTANCE"`
+}
+
+// Log — логи в JSON. Level меняется без перезапуска через PUT /admin/log/level
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" validate:"oneof=debug info warn error"`
+}
+
+// Outbox — реле доменных событий: раз в PollInterval публикует в Topic пачки до BatchSize событий,
+// опубликованные строки хранятся Retention и удаляются раз в PruneInterval
+type Outbox struct {
+	Topic        string        `yaml:"topic" env:"OUTBOX_TOPIC" validate:"required"`
+	PollInterval time.Duration `yaml:"poll_interval" validate:"gt=0"`
+	BatchSize    int           `yaml:"batch_size" validate:"min=1,max=10000"`
+	// Lease — аренда публикации: пока она не истекла, другие инстансы не публикуют; пачка публикуется не дольше Lease
+	Lease         time.Duration `yaml:"lease" validate:"gt=0"`
+	Retention     time.Duration `yaml:"retention" validate:"gte=0"`
+	PruneInterval time.Duration `yaml:"prune_interval" validate:"gt=0"`
+}
+
+// Health — проверки /readyz. DrainDelay — пауза между переводом в not ready и остановкой HTTP-сервера,
+// за которую балансировщик успевает убрать инстанс
+type Health struct {
+	Timeout    time.Duration `yaml:"timeout" validate:"gt=0"`
+	DrainDelay time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" validate:"gte=0"`
+}
+
+// WarmUp — прогрев кеша при старте: не больше Orders последних заказов не старше Window (0 — без ограничения)
+type WarmUp struct {
+	Orders int           `yaml:"orders" env:"WARMUP_ORDERS" validate:"min=0"`
+	Batch  int           `yaml:"batch" env:"WARMUP_BATCH" validate:"min=1"`
+	Window time.Duration `yaml:"window" env:"WARMUP_WINDOW" validate:"gte=0"`
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Port:              9000,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       time.Minute,
+			ShutdownTimeout:   10 * time.Second,
+		},
+		DB: DB{
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			Migrate:         "auto",
+			Breaker:         Breaker{FailureThreshold: 5, OpenTimeout: 5 * time.Second},
+			AcquireTimeout:  time.Second,
+			Retry: Retry{
+				MaxRetries:  3,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    2 * time.Second,
+				BudgetRatio: 0.1,
+				BudgetBurst: 10,
+			},
+		},
+		Kafka: Kafka{
+			Topic:         "orders",
+			GroupID:       "GroupID",
+			Workers:       20,
+			ShardBy:       "key",
+			WorkerQueue:   16,
+			BatchSize:     1,
+			BatchLinger:   20 * time.Millisecond,
+			DLQMaxRetries: 5,
+			StatsInterval: 15 * time.Second,
+		},
+		Redis: Redis{
+			Port:      6379,
+			TTL:       time.Hour,
+			LocalSize: 1000,
+			LocalTTL:  time.Minute,
+
+			InvalidationChannel: "orders:cache:invalidate",
+			Breaker:             Breaker{FailureThreshold: 5, OpenTimeout: 10 * time.Second},
+			ProbeInterval:       2 * time.Second,
+		},
+		Tracer: Tracer{
+			Exporter:    "otlp-grpc",
+			SampleRatio: 1,
+			ServiceName: "Orders Service",
+			Version:     "dev",
+			Environment: "development",
+		},
+		Log: Log{
+			Level: "info",
+		},
+		WarmUp: WarmUp{
+			Orders: 1000,
+			Batch:  100,
+		},
+		Health: Health{
+			Timeout:    2 * time.Second,
+			DrainDelay: 5 * time.Second,
+		},
+		Outbox: Outbox{
+			Topic:         "orders.events",
+			PollInterval:  time.Second,
+			BatchSize:     100,
+			Lease:         30 * time.Second,
+			Retention:     24 * time.Hour,
+			PruneInterval: 10 * time.Minute,
+		},
+		FillData: true,
+	}
+}
+
+// Principals возвращает имена клиентов по их токенам
+func (h HTTP) Principals() map[string]string {
+	principals := make(map[string]string, len(h.Tokens))
+
+	for _, entry := range h.Tokens {
+		name, token, _ := strings.Cut(entry, ":")
+		principals[token] = name
+	}
+
+	return principals
+}
+
+// Addr возвращает адрес Redis в виде host:port
+func (r Redis) Addr() string {
+	return r.Host + ":" + strconv.Itoa(r.Port)
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// Load собирает конфигурацию: значения по умолчанию, затем YAML-файл path (если задан),
+// затем переменные окружения. Результат проверяется, ошибки перечисляют все неверные поля
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("read config: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return Config{}, err
+	}
+
+	if err := validate(cfg); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv проходит по полям с тегом env и подставляет непустые значения переменных окружения
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+
+	for i := range t.NumField() {
+		field, value := t.Field(i), v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[time.Duration]() {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("env %s=%q: %w", name, raw, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeFor[time.Duration]():
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		// Список задается через запятую: KAFKA_HOST=kafka-1:9092,kafka-2:9092
+		parts := strings.Split(raw, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+
+		v.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// validate проверяет конфигурацию; поля в сообщениях называются путями из YAML, например kafka.brokers[0]
+func validate(cfg Config) error {
+	valid := validator.New(validator.WithRequiredStructEnabled())
+
+	valid.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		return name
+	})
+
+	// credential — строка name:token с непустыми частями
+	_ = valid.RegisterValidation("credential", func(fl validator.FieldLevel) bool {
+		name, token, ok := strings.Cut(fl.Field().String(), ":")
+		return ok && name != "" && token != ""
+	})
+
+	err := valid.Struct(cfg)
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	problems := make([]string, 0, len(validationErrs))
+
+	for _, e := range validationErrs {
+		_, field, _ := strings.Cut(e.Namespace(), ".")
+
+		if secret(reflect.TypeOf(cfg), e.StructNamespace()) {
+			problems = append(problems, fmt.Sprintf("%s: %s", field, rule(e)))
+			continue
+		}
+
+		problems = append(problems, fmt.Sprintf("%s: %s (got %v)", field, rule(e), e.Value()))
+	}
+
+	return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// secret сообщает, помечено ли поле по пути namespace (Config.DB.URL, Config.HTTP.Tokens[0]) тегом secret:
+// значения таких полей не попадают в ошибки
+func secret(t reflect.Type, namespace string) bool {
+	parts := strings.Split(namespace, ".")[1:]
+
+	for i, part := range parts {
+		name, _, _ := strings.Cut(part, "[")
+
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return false
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			return true
+		}
+
+		if i < len(parts)-1 {
+			t = field.Type
+		}
+	}
+
+	return false
+}
+
+func rule(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "url":
+		return "must be a URL"
+	case "hostname_port":
+		return "must be host:port"
+	case "credential":
+		return "must be name:token"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(e.Param(), " ", ", ")
+	case "min", "gte":
+		return "must be at least " + e.Param()
+	case "max", "lte":
+		return "must be at most " + e.Param()
+	case "gt":
+		return "must be greater than " + e.Param()
+	case "ltefield":
+		return "must not exceed " + snakeCase(e.Param())
+	case "gtefield":
+		return "must be at least " + snakeCase(e.Param())
+	default:
+		return fmt.Sprintf("must satisfy %s=%s", e.Tag(), e.Param())
+	}
+}
+
+// snakeCase переводит имя поля Go в имя ключа YAML: MaxOpenConns -> max_open_conns
+func snakeCase(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -2,6 +2,10 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"orders/src/config"
+	"orders/src/logger"
 
 	_ "github.com/jackc/pgx/v5/stdlib" // Dont need an named import
 	"github.com/jmoiron/sqlx"
@@ -14,16 +18,31 @@ type DB struct {
 	Pool *sqlx.DB
 }
 
-func NewDBConnection(ctx context.Context, tp *trace.TracerProvider, connString string) (*DB, error) {
-	pool, err := otelsqlx.ConnectContext(ctx, "pgx", connString, otelsql.WithTracerProvider(tp))
+// NewDBConnection открывает пул и приводит схему к встроенным миграциям (или проверяет ее) согласно cfg.Migrate
+func NewDBConnection(ctx context.Context, tp *trace.TracerProvider, log *slog.Logger, cfg config.DB) (*DB, error) {
+	pool, err := otelsqlx.ConnectContext(ctx, "pgx", cfg.URL, otelsql.WithTracerProvider(tp))
 
 	if err != nil {
 		return nil, err
 	}
 
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := migrateSchema(cfg, logger.Component(log, "migrate")); err != nil {
+		_ = pool.Close()
+		return nil, fmt.Errorf("migrations: %w", err)
+	}
+
 	return &DB{Pool: pool}, nil
 }
 
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Pool.PingContext(ctx)
+}
+
 func (db *DB) Close() error {
 	return db.Pool.Close()
 }
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders/src/circuitbreaker"
+	"orders/src/config"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrUnavailable — запрос отклонен без обращения к БД: автомат открыт или все соединения заняты дольше AcquireTimeout
+var ErrUnavailable = errors.New("database unavailable")
+
+const breakerName = "postgres"
+
+// Причины отказа в метрике db_guard_rejections_total
+const (
+	rejectOpen     = "open"
+	rejectBulkhead = "bulkhead"
+	rejectBudget   = "retry_budget"
+)
+
+// Guard — общая защита репозиториев: ограничение параллельных запросов размером пула, автомат и повторы в рамках бюджета.
+// Один Guard на пул: лимит и автомат общие для всех репозиториев
+type Guard struct {
+	sem            *semaphore.Weighted
+	acquireTimeout time.Duration
+	breaker        *circuitbreaker.Breaker
+	budget         *retryBudget
+	maxRetries     int
+	backoff        func() retry.Backoff
+	metrics        *metrics.Metrics
+}
+
+func NewGuard(cfg config.DB, m *metrics.Metrics, log *slog.Logger) *Guard {
+	log = logger.Component(log, "db-guard")
+
+	m.CircuitBreakerState.WithLabelValues(breakerName).Set(float64(circuitbreaker.Closed))
+
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		Name:             breakerName,
+		FailureThreshold: cfg.Breaker.FailureThreshold,
+		OpenTimeout:      cfg.Breaker.OpenTimeout,
+		OnStateChange: func(name string, from, to circuitbreaker.State) {
+			log.Warn("circuit breaker state changed", "breaker", name, "from", from.String(), "to", to.String())
+			m.CircuitBreakerState.WithLabelValues(name).Set(float64(to))
+		},
+	})
+
+	return &Guard{
+		sem:            semaphore.NewWeighted(int64(cfg.MaxOpenConns)),
+		acquireTimeout: cfg.AcquireTimeout,
+		breaker:        breaker,
+		budget:         newRetryBudget(cfg.Retry.BudgetRatio, cfg.Retry.BudgetBurst),
+		maxRetries:     cfg.Retry.MaxRetries,
+		backoff: func() retry.Backoff {
+			b := retry.NewExponential(cfg.Retry.BaseDelay)
+			b = retry.WithJitterPercent(20, b)
+			b = retry.WithCappedDuration(cfg.Retry.MaxDelay, b)
+			return retry.WithMaxRetries(uint64(cfg.Retry.MaxRetries), b)
+		},
+		metrics: m,
+	}
+}
+
+// Do выполняет fn, повторяя временные ошибки БД (IsRetryable), пока позволяют лимит повторов и бюджет.
+// Транзакция целиком — одно выполнение fn: fn занимает одно место в лимите на все время выполнения
+func (g *Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	g.budget.deposit()
+
+	retries := 0
+
+	return retry.Do(ctx, g.backoff(), func(ctx context.Context) error {
+		err := g.call(ctx, fn)
+
+		if !IsRetryable(err) || retries == g.maxRetries {
+			return err
+		}
+
+		// Бюджет исчерпан — возвращаем ошибку как есть, без повтора
+		if !g.budget.withdraw() {
+			g.metrics.DBGuardRejections.WithLabelValues(rejectBudget).Inc()
+			return err
+		}
+
+		retries++
+
+		return retry.RetryableError(err)
+	})
+}
+
+func (g *Guard) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	acquireCtx, cancel := context.WithTimeout(ctx, g.acquireTimeout)
+	defer cancel()
+
+	if err := g.sem.Acquire(acquireCtx, 1); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		g.metrics.DBGuardRejections.WithLabelValues(rejectBulkhead).Inc()
+
+		return fmt.Errorf("%w: all %s connections are busy", ErrUnavailable, breakerName)
+	}
+	defer g.sem.Release(1)
+
+	err := g.breaker.Execute(func() error { return fn(ctx) }, isFailure)
+
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		g.metrics.DBGuardRejections.WithLabelValues(rejectOpen).Inc()
+
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// isFailure — ошибки, говорящие о недоступности БД. Нарушения ограничений, отсутствие строки и отмена запроса
+// клиентом автомат не открывают
+func isFailure(err error) bool {
+	return IsRetryable(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryBudget ограничивает долю повторов: при массовых отказах повторы не умножают нагрузку на БД
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	max    float64
+}
+
+func newRetryBudget(ratio float64, burst int) *retryBudget {
+	return &retryBudget{tokens: float64(burst), ratio: ratio, max: float64(burst)}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.max, b.tokens+b.ratio)
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
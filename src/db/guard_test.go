@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"orders/src/circuitbreaker"
+	"orders/src/config"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+func newTestGuard(retry config.Retry) (*Guard, *metrics.Metrics) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg, reg)
+
+	cfg := config.Default().DB
+	cfg.MaxOpenConns = 1
+	cfg.AcquireTimeout = 10 * time.Millisecond
+	cfg.Breaker = config.Breaker{FailureThreshold: 3, OpenTimeout: time.Minute}
+	cfg.Retry = retry
+
+	return NewGuard(cfg, m, logger.Discard()), m
+}
+
+func TestGuard_RetriesTransientErrors(t *testing.T) {
+	guard, _ := newTestGuard(config.Retry{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BudgetBurst: 10})
+
+	calls := 0
+
+	err := guard.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errDown
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// Постоянные ошибки не повторяются и автомат не открывают
+	calls = 0
+	notFound := errors.New("not found")
+
+	for range 5 {
+		require.ErrorIs(t, guard.Do(context.Background(), func(context.Context) error {
+			calls++
+			return notFound
+		}), notFound)
+	}
+
+	require.Equal(t, 5, calls)
+	require.Equal(t, circuitbreaker.Closed, guard.breaker.State())
+}
+
+func TestGuard_FailsFastWhenOpen(t *testing.T) {
+	guard, m := newTestGuard(config.Retry{MaxRetries: 0, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	for range 3 {
+		require.ErrorIs(t, guard.Do(context.Background(), func(context.Context) error { return errDown }), errDown)
+	}
+
+	require.Equal(t, float64(circuitbreaker.Open), testutil.ToFloat64(m.CircuitBreakerState.WithLabelValues("postgres")))
+
+	called := false
+	err := guard.Do(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+
+	require.ErrorIs(t, err, ErrUnavailable)
+	require.False(t, called)
+	require.Equal(t, float64(1), testutil.ToFloat64(m.DBGuardRejections.WithLabelValues("open")))
+}
+
+func TestGuard_RetryBudget(t *testing.T) {
+	guard, m := newTestGuard(config.Retry{MaxRetries: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BudgetRatio: 0, BudgetBurst: 2})
+
+	calls := 0
+
+	err := guard.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errDown
+	})
+
+	// Первая попытка и два повтора из бюджета, дальше ошибка возвращается как есть
+	require.ErrorIs(t, err, errDown)
+	require.Equal(t, 3, calls)
+	require.Equal(t, float64(1), testutil.ToFloat64(m.DBGuardRejections.WithLabelValues("retry_budget")))
+}
+
+func TestGuard_Bulkhead(t *testing.T) {
+	guard, m := newTestGuard(config.Retry{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		_ = guard.Do(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+
+	<-started
+
+	err := guard.Do(context.Background(), func(context.Context) error { return nil })
+
+	close(release)
+
+	require.ErrorIs(t, err, ErrUnavailable)
+	require.Equal(t, float64(1), testutil.ToFloat64(m.DBGuardRejections.WithLabelValues("bulkhead")))
+}
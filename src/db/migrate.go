@@ -0,0 +1,208 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"orders/src/config"
+	"orders/src/db/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Режимы миграций при старте (db.migrate)
+const (
+	MigrateAuto   = "auto"   // применить недостающие миграции
+	MigrateVerify = "verify" // только проверить, что схема совпадает с кодом
+	MigrateOff    = "off"
+)
+
+var (
+	// ErrSchemaDirty — предыдущая миграция упала посередине, схему нужно починить вручную и выполнить migrate force
+	ErrSchemaDirty = errors.New("database schema is dirty")
+	// ErrSchemaAhead — в БД применены миграции, которых нет в этой версии сервиса
+	ErrSchemaAhead = errors.New("database schema is ahead of the code")
+	// ErrSchemaBehind — в БД не хватает миграций, а режим не позволяет их применить
+	ErrSchemaBehind = errors.New("database schema is behind the code")
+)
+
+// MigrationStatus — версия схемы в БД и последняя встроенная миграция. Version = 0 — миграции не применялись
+type MigrationStatus struct {
+	Version uint
+	Latest  uint
+	Dirty   bool
+}
+
+// Migrator применяет встроенные миграции. Каждая операция берет advisory lock в PostgreSQL,
+// поэтому реплики, стартующие одновременно, не применяют миграции параллельно
+type Migrator struct {
+	m      *migrate.Migrate
+	latest uint
+	log    *slog.Logger
+}
+
+// NewMigrator открывает отдельное соединение: Close драйвера миграций закрывает и *sql.DB
+func NewMigrator(url string, log *slog.Logger) (*Migrator, error) {
+	conn, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := pgxmigrate.WithInstance(conn, &pgxmigrate.Config{})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("migrations driver: %w", err)
+	}
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		_ = driver.Close()
+		return nil, fmt.Errorf("migrations source: %w", err)
+	}
+
+	latest, err := latestVersion(src)
+	if err != nil {
+		_ = driver.Close()
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "pgx5", driver)
+	if err != nil {
+		_ = driver.Close()
+		return nil, err
+	}
+
+	return &Migrator{m: m, latest: latest, log: log}, nil
+}
+
+// latestVersion — версия последней встроенной миграции
+func latestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("first migration: %w", err)
+	}
+
+	for {
+		next, err := src.Next(version)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("next migration after %d: %w", version, err)
+		}
+
+		version = next
+	}
+}
+
+func (m *Migrator) Status() (MigrationStatus, error) {
+	version, dirty, err := m.m.Version()
+
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{Latest: m.latest}, nil
+	}
+
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	return MigrationStatus{Version: version, Latest: m.latest, Dirty: dirty}, nil
+}
+
+// Verify проверяет, что схема в БД совпадает с последней встроенной миграцией
+func (m *Migrator) Verify() error {
+	status, err := m.check()
+	if err != nil {
+		return err
+	}
+
+	if status.Version < status.Latest {
+		return fmt.Errorf("%w: version %d, code expects %d", ErrSchemaBehind, status.Version, status.Latest)
+	}
+
+	return nil
+}
+
+// Up применяет недостающие миграции. Грязную схему и схему новее кода не трогает
+func (m *Migrator) Up() error {
+	status, err := m.check()
+	if err != nil {
+		return err
+	}
+
+	if status.Version == status.Latest {
+		return nil
+	}
+
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+
+	m.log.Info("migrations applied", "from", status.Version, "to", status.Latest)
+
+	return nil
+}
+
+// Down откатывает steps последних миграций
+func (m *Migrator) Down(steps int) error {
+	if _, err := m.check(); err != nil {
+		return err
+	}
+
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("roll back migrations: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) check() (MigrationStatus, error) {
+	status, err := m.Status()
+	if err != nil {
+		return status, err
+	}
+
+	switch {
+	case status.Dirty:
+		return status, fmt.Errorf("%w: version %d", ErrSchemaDirty, status.Version)
+	case status.Version > status.Latest:
+		return status, fmt.Errorf("%w: version %d, code knows up to %d", ErrSchemaAhead, status.Version, status.Latest)
+	}
+
+	return status, nil
+}
+
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// migrateSchema применяет или проверяет миграции при старте в зависимости от cfg.Migrate
+func migrateSchema(cfg config.DB, log *slog.Logger) error {
+	if cfg.Migrate == MigrateOff {
+		return nil
+	}
+
+	m, err := NewMigrator(cfg.URL, log)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			log.Error("close migrator failed", "error", err)
+		}
+	}()
+
+	if cfg.Migrate == MigrateAuto {
+		return m.Up()
+	}
+
+	return m.Verify()
+}
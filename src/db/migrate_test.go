@@ -0,0 +1,29 @@
+package db
+
+import (
+	"io/fs"
+	"orders/src/db/migrations"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	src, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+
+	latest, err := latestVersion(src)
+	require.NoError(t, err)
+
+	files, err := fs.Glob(migrations.FS, "*.up.sql")
+	require.NoError(t, err)
+	require.Equal(t, len(files), int(latest), "versions must be sequential")
+
+	// У каждой миграции есть откат
+	for _, up := range files {
+		_, err := fs.Stat(migrations.FS, strings.TrimSuffix(up, ".up.sql")+".down.sql")
+		require.NoError(t, err, up)
+	}
+}
@@ -0,0 +1,8 @@
+alter table item
+drop constraint item_order_id_rid_key;
+
+alter table payment
+drop constraint payment_transaction_key;
+
+alter table "order"
+drop constraint order_order_uid_key;
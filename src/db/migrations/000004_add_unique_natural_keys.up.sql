@@ -0,0 +1,27 @@
+-- Перед созданием уникальных ключей удаляем накопившиеся дубли, оставляя самую раннюю запись
+
+delete from "order" a using "order" b
+where a.order_uid = b.order_uid and a.id > b.id;
+
+-- Заказы, ссылающиеся на дубль оплаты, переводим на оставляемую оплату
+update "order" o
+set payment_id = keep.id
+from payment p
+join (select transaction, min(id) as id from payment group by transaction) keep on keep.transaction = p.transaction
+where o.payment_id = p.id and p.id <> keep.id;
+
+delete from payment a using payment b
+where a.transaction = b.transaction and a.id > b.id;
+
+-- rid уникален только в пределах заказа
+delete from item a using item b
+where a.order_id = b.order_id and a.rid = b.rid and a.id > b.id;
+
+alter table "order"
+add constraint order_order_uid_key unique (order_uid);
+
+alter table payment
+add constraint payment_transaction_key unique (transaction);
+
+alter table item
+add constraint item_order_id_rid_key unique (order_id, rid);
@@ -0,0 +1,9 @@
+drop index item_brand_idx;
+
+drop index item_nm_id_idx;
+
+drop index order_track_number_idx;
+
+drop index order_customer_id_idx;
+
+drop index order_date_created_id_idx;
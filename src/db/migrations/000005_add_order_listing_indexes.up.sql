@@ -0,0 +1,10 @@
+-- Keyset-пагинация списка заказов идет по (date_created, id) от новых к старым
+create index order_date_created_id_idx on "order" (date_created desc, id desc);
+
+create index order_customer_id_idx on "order" (customer_id);
+
+create index order_track_number_idx on "order" (track_number);
+
+create index item_nm_id_idx on item (nm_id);
+
+create index item_brand_idx on item (brand);
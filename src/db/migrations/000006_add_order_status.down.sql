@@ -0,0 +1,3 @@
+drop table order_status_history;
+
+alter table "order" drop column status;
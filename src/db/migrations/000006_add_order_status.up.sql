@@ -0,0 +1,17 @@
+alter table "order"
+    add column status varchar(32) not null default 'created'
+        constraint order_status_check
+            check (status in ('created', 'paid', 'assembling', 'shipped', 'delivered', 'cancelled', 'returned'));
+
+create table
+    order_status_history (
+        id bigserial primary key,
+        order_id integer not null references "order" (id) on delete cascade,
+        from_status varchar(32) not null,
+        to_status varchar(32) not null,
+        actor varchar(255) not null,
+        reason text not null default '',
+        created_at timestamptz not null default now()
+    );
+
+create index order_status_history_order_id_idx on order_status_history (order_id, id);
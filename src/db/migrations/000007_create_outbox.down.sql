@@ -0,0 +1,3 @@
+drop table outbox_lease;
+
+drop table outbox;
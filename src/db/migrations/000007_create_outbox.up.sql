@@ -0,0 +1,26 @@
+-- Доменные события пишутся в одной транзакции с заказом и публикуются в Kafka реле (src/outbox)
+create table
+    outbox (
+        id bigserial primary key,
+        aggregate_id integer not null,
+        event_type varchar(64) not null,
+        event_key varchar(255) not null,
+        payload jsonb not null,
+        headers jsonb not null default '{}',
+        created_at timestamptz not null default now(),
+        published_at timestamptz,
+        -- Транзакция, записавшая событие: реле не берет события транзакций, которые еще могут закоммититься
+        txid bigint not null default txid_current()
+    );
+
+create index outbox_unpublished_idx on outbox (id) where published_at is null;
+
+create index outbox_published_at_idx on outbox (published_at) where published_at is not null;
+
+-- Аренда публикации: публикует только инстанс owner, пока не истек expires_at
+create table
+    outbox_lease (
+        id integer primary key check (id = 1),
+        owner varchar(64) not null,
+        expires_at timestamptz not null
+    );
@@ -0,0 +1,26 @@
+drop index if exists item_order_id_idx;
+
+alter table item
+alter column order_id drop not null;
+
+alter table payment
+drop constraint if exists payment_order_id_key,
+alter column order_id drop not null;
+
+alter table delivery
+drop constraint if exists delivery_order_id_key,
+alter column order_id drop not null;
+
+alter table "order"
+add column delivery_id integer references delivery (id) on delete cascade,
+add column payment_id integer references payment (id) on delete cascade;
+
+update "order" o
+set delivery_id = d.id
+from delivery d
+where d.order_id = o.id;
+
+update "order" o
+set payment_id = p.id
+from payment p
+where p.order_id = o.id;
@@ -0,0 +1,56 @@
+-- Заказ — единственный владелец: доставка, оплата и товары ссылаются на него через order_id,
+-- обратные ссылки order.delivery_id и order.payment_id удаляются
+
+-- Обратные ссылки нужны только для выбора оставляемых записей. Внешние ключи снимаются сразу:
+-- их on delete cascade удалил бы заказ вместе с дублем доставки или оплаты, на который он ссылается
+alter table "order"
+drop constraint order_delivery_id_fkey,
+drop constraint order_payment_id_fkey;
+
+-- Переносим связь туда, где order_id еще не проставлен (агрегат мог упасть между вставкой и привязкой)
+update delivery d
+set order_id = o.id
+from "order" o
+where o.delivery_id = d.id and d.order_id is null;
+
+update payment p
+set order_id = o.id
+from "order" o
+where o.payment_id = p.id and p.order_id is null;
+
+-- Записи без заказа ни в один агрегат не попадают
+delete from delivery where order_id is null;
+
+delete from payment where order_id is null;
+
+delete from item where order_id is null;
+
+-- У заказа остаются одна доставка и одна оплата: та, на которую он ссылался, иначе самая ранняя
+delete from delivery d using "order" o
+where d.order_id = o.id and o.delivery_id is not null and d.id <> o.delivery_id;
+
+delete from delivery a using delivery b
+where a.order_id = b.order_id and a.id > b.id;
+
+delete from payment p using "order" o
+where p.order_id = o.id and o.payment_id is not null and p.id <> o.payment_id;
+
+delete from payment a using payment b
+where a.order_id = b.order_id and a.id > b.id;
+
+alter table "order"
+drop column delivery_id,
+drop column payment_id;
+
+alter table delivery
+alter column order_id set not null,
+add constraint delivery_order_id_key unique (order_id);
+
+alter table payment
+alter column order_id set not null,
+add constraint payment_order_id_key unique (order_id);
+
+alter table item
+alter column order_id set not null;
+
+create index item_order_id_idx on item (order_id);
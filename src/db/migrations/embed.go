@@ -0,0 +1,7 @@
+// Package migrations встраивает SQL-миграции в бинарник. Файлы создаются через make create-migration
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -15,6 +15,7 @@ type Order struct {
 	SmID              int       `db:"sm_id" json:"sm_id" validate:"required,number"`
 	DateCreated       time.Time `db:"date_created" json:"date_created" validate:"required"`
 	OofShard          string    `db:"oof_shard" json:"oof_shard" validate:"required,numeric"`
-	DeliveryID        int       `db:"delivery_id" json:"delivery_id" validate:"required,number"`
-	PaymentID         int       `db:"payment_id" json:"payment_id" validate:"required,number"`
+
+	// Status меняется только через смену статуса; при создании заказ всегда created
+	Status OrderStatus `db:"status" json:"status,omitempty"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// OutboxEvent — строка outbox: событие, которое реле должно опубликовать в Kafka.
+// Payload — JSON события, Headers — JSON-объект с контекстом трассировки на момент записи
+type OutboxEvent struct {
+	ID          int64      `db:"id"`
+	AggregateID int        `db:"aggregate_id"`
+	EventType   string     `db:"event_type"`
+	Key         string     `db:"event_key"`
+	Payload     []byte     `db:"payload"`
+	Headers     []byte     `db:"headers"`
+	CreatedAt   time.Time  `db:"created_at"`
+	PublishedAt *time.Time `db:"published_at"`
+}
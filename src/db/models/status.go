@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// OrderStatus — статус заказа. Допустимые переходы между статусами задает service.CanTransition
+type OrderStatus string
+
+const (
+	StatusCreated    OrderStatus = "created"
+	StatusPaid       OrderStatus = "paid"
+	StatusAssembling OrderStatus = "assembling"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusReturned   OrderStatus = "returned"
+)
+
+// StatusChange — запись истории статусов: кто, когда и почему перевел заказ из From в To
+type StatusChange struct {
+	ID        int64       `db:"id" json:"id"`
+	OrderID   int         `db:"order_id" json:"order_id"`
+	From      OrderStatus `db:"from_status" json:"from"`
+	To        OrderStatus `db:"to_status" json:"to"`
+	Actor     string      `db:"actor" json:"actor"`
+	Reason    string      `db:"reason" json:"reason"`
+	CreatedAt time.Time   `db:"created_at" json:"created_at"`
+}
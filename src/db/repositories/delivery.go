@@ -2,15 +2,15 @@ package repositories
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/logger"
 	"orders/src/metrics"
-	"orders/src/myretry"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/sethvargo/go-retry"
 )
 
 type DeliveryRepository interface {
@@ -21,13 +21,13 @@ type DeliveryRepository interface {
 
 type deliveryRepo struct {
 	pool    *sqlx.DB
-	b       func() retry.Backoff
+	guard   *db.Guard
 	metrics *metrics.Metrics
+	log     *slog.Logger
 }
 
-func NewDeliveryRepo(pool *sqlx.DB, metrics *metrics.Metrics) DeliveryRepository {
-	b := myretry.NewBackofFactory()
-	return &deliveryRepo{pool: pool, b: b, metrics: metrics}
+func NewDeliveryRepo(pool *sqlx.DB, guard *db.Guard, metrics *metrics.Metrics, log *slog.Logger) DeliveryRepository {
+	return &deliveryRepo{pool: pool, guard: guard, metrics: metrics, log: logger.Component(log, "delivery-repo")}
 }
 
 func (repo *deliveryRepo) CreateDelivery(ctx context.Context, deliveryDto *models.Delivery) (models.Delivery, error) {
@@ -35,14 +35,14 @@ func (repo *deliveryRepo) CreateDelivery(ctx context.Context, deliveryDto *model
 	var delivery models.Delivery
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		delivery, err = repo.createDelivery(ctx, repo.pool, deliveryDto)
 
-		delivery, err = repo.createDelivery(ctx, deliveryDto)
+		if errors.Is(err, errDuplicate) {
+			repo.metrics.DuplicatesDetected.WithLabelValues("delivery").Inc()
+			repo.log.InfoContext(ctx, "duplicate delivery, returning existing", "order_id", deliveryDto.OrderID)
 
-		if db.IsRetryable(err) {
-			log.Printf("ERROR IN CreateDelivery, retry...\n")
-			log.Printf("%v\n", err)
-			return retry.RetryableError(err)
+			delivery, err = repo.getDeliveryByOrderID(ctx, deliveryDto.OrderID)
 		}
 
 		return err
@@ -51,18 +51,19 @@ func (repo *deliveryRepo) CreateDelivery(ctx context.Context, deliveryDto *model
 	return delivery, err
 }
 
-func (repo *deliveryRepo) createDelivery(ctx context.Context, deliveryDto *models.Delivery) (models.Delivery, error) {
+func (repo *deliveryRepo) createDelivery(ctx context.Context, q sqlx.ExtContext, deliveryDto *models.Delivery) (models.Delivery, error) {
 	start := time.Now()
 
 	var delivery models.Delivery
 
 	query := `
-     INSERT INTO delivery (name, phone, zip, city, address, region, email)
-VALUES (:name, :phone, :zip, :city, :address, :region, :email)
-RETURNING id, name, phone, zip, city, address, region, email;
+     INSERT INTO delivery (name, phone, zip, city, address, region, email, order_id)
+VALUES (:name, :phone, :zip, :city, :address, :region, :email, :order_id)
+ON CONFLICT (order_id) DO NOTHING
+RETURNING id, name, phone, zip, city, address, region, email, order_id;
     `
 
-	rows, err := repo.pool.NamedQueryContext(ctx, query, &deliveryDto)
+	rows, err := sqlx.NamedQueryContext(ctx, q, query, deliveryDto)
 
 	lat := time.Since(start).Seconds()
 	repo.metrics.DBQueryDuration.WithLabelValues("create_delivery", "delivery_service").Observe(lat)
@@ -75,28 +76,68 @@ RETURNING id, name, phone, zip, city, address, region, email;
 
 	defer rows.Close()
 
-	for rows.Next() {
-		if err = rows.StructScan(&delivery); err != nil {
-			log.Printf("Error while parsing  rows %v", err)
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
 			return models.Delivery{}, err
 		}
+
+		return models.Delivery{}, errDuplicate
+	}
+
+	if err = rows.StructScan(&delivery); err != nil {
+		repo.log.ErrorContext(ctx, "scan row", "query", "create_delivery", "error", err)
+		return models.Delivery{}, err
 	}
 
 	return delivery, nil
 }
 
+func (repo *deliveryRepo) createDeliveries(ctx context.Context, q sqlx.ExtContext, deliveryDtos []models.Delivery) ([]models.Delivery, error) {
+	start := time.Now()
+
+	n := len(deliveryDtos)
+	names, phones, zips, cities := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	addresses, regions, emails, orderIDs := make([]string, n), make([]string, n), make([]string, n), make([]int64, n)
+
+	for i, d := range deliveryDtos {
+		names[i], phones[i], zips[i], cities[i] = d.Name, d.Phone, d.Zip, d.City
+		addresses[i], regions[i], emails[i], orderIDs[i] = d.Address, d.Region, d.Email, int64(d.OrderID)
+	}
+
+	query := `
+     INSERT INTO delivery (name, phone, zip, city, address, region, email, order_id)
+SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::varchar[], $5::varchar[], $6::varchar[], $7::varchar[], $8::int[])
+ON CONFLICT (order_id) DO NOTHING
+RETURNING id, name, phone, zip, city, address, region, email, order_id;
+    `
+
+	var deliveries []models.Delivery
+
+	err := sqlx.SelectContext(ctx, q, &deliveries, query, names, phones, zips, cities, addresses, regions, emails, orderIDs)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_deliveries", "delivery_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_deliveries", "delivery_service").Inc()
+
+		return nil, err
+	}
+
+	if len(deliveries) < n {
+		return nil, errDuplicate
+	}
+
+	return deliveries, nil
+}
+
 func (repo *deliveryRepo) GetDeliveryByID(ctx context.Context, deliveryID int) (models.Delivery, error) {
 	var delivery models.Delivery
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		delivery, err = repo.getDeliveryByID(ctx, deliveryID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
 	})
 
@@ -117,7 +158,7 @@ func (repo *deliveryRepo) getDeliveryByID(ctx context.Context, deliveryID int) (
 	repo.metrics.DBQueryDuration.WithLabelValues("get_delivery_by_id", "delivery_service").Observe(lat)
 
 	if err != nil {
-		log.Printf("Error in GetDeliveryByID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_delivery_by_id", err)
 		repo.metrics.DBQueryErrors.WithLabelValues("get_delivery_by_id", "delivery_service").Inc()
 
 		return models.Delivery{}, err
@@ -130,14 +171,9 @@ func (repo *deliveryRepo) GetDeliveryByOrderID(ctx context.Context, orderID int)
 	var delivery models.Delivery
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		delivery, err = repo.getDeliveryByOrderID(ctx, orderID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
 	})
 
@@ -159,7 +195,7 @@ func (repo *deliveryRepo) getDeliveryByOrderID(ctx context.Context, orderID int)
 	repo.metrics.DBQueryDuration.WithLabelValues("get_delivery_by_order_id", "delivery_service").Observe(lat)
 
 	if err != nil {
-		log.Printf("Error in GetDeliveryByOrderID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_delivery_by_order_id", err)
 		repo.metrics.DBQueryErrors.WithLabelValues("get_delivery_by_order_id", "delivery_service").Inc()
 
 		return models.Delivery{}, err
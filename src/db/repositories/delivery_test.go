@@ -10,15 +10,18 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 
+	"orders/src/config"
+	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/logger"
 	"orders/src/metrics"
 )
 
 func newTestRepo(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock, *DeliveryRepository) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	require.NoError(t, err)
 
-	sqlxDB := sqlx.NewDb(db, "sqlmock")
+	sqlxDB := sqlx.NewDb(conn, "sqlmock")
 
 	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "test_db_query_duration_seconds",
@@ -30,11 +33,13 @@ func newTestRepo(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock, *DeliveryRepository)
 	}, []string{"query", "service"})
 
 	m := &metrics.Metrics{
-		DBQueryDuration: hist,
-		DBQueryErrors:   counter,
+		DBQueryDuration:     hist,
+		DBQueryErrors:       counter,
+		DBGuardRejections:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_db_guard_rejections_total"}, []string{"reason"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_circuit_breaker_state"}, []string{"name"}),
 	}
 
-	repo := NewDeliveryRepo(sqlxDB, m)
+	repo := NewDeliveryRepo(sqlxDB, db.NewGuard(config.Default().DB, m, logger.Discard()), m, logger.Discard())
 
 	return sqlxDB, mock, &repo
 }
@@ -51,19 +56,21 @@ func TestCreateDelivery_Success(t *testing.T) {
 		Address: "Lenina 1",
 		Region:  "Moscow",
 		Email:   "ivan@example.com",
+		OrderID: 1001,
 	}
 
-	columns := []string{"id", "name", "phone", "zip", "city", "address", "region", "email"}
+	columns := []string{"id", "name", "phone", "zip", "city", "address", "region", "email", "order_id"}
 	rows := sqlmock.NewRows(columns).
-		AddRow(42, in.Name, in.Phone, in.Zip, in.City, in.Address, in.Region, in.Email)
+		AddRow(42, in.Name, in.Phone, in.Zip, in.City, in.Address, in.Region, in.Email, in.OrderID)
 
-	mock.ExpectQuery(`(?s)^INSERT INTO delivery.*RETURNING id, name, phone, zip, city, address, region, email;?$`).WillReturnRows(rows)
+	mock.ExpectQuery(`(?s)^INSERT INTO delivery.*ON CONFLICT \(order_id\) DO NOTHING.*RETURNING id, name, phone, zip, city, address, region, email, order_id;?$`).WillReturnRows(rows)
 
 	ctx := context.Background()
 	delivery, err := (*repoPtr).CreateDelivery(ctx, in)
 	require.NoError(t, err)
 	require.Equal(t, 42, delivery.ID)
 	require.Equal(t, in.Name, delivery.Name)
+	require.Equal(t, 1001, delivery.OrderID)
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+var (
+	// ErrConflict — transaction уже занят другим заказом или rid повторяется в заказе
+	ErrConflict = errors.New("natural key conflict")
+
+	// errDuplicate — INSERT ... ON CONFLICT DO NOTHING не вставил строку: запись с таким ключом уже есть
+	errDuplicate = errors.New("duplicate record")
+
+	// ErrNotFound — заказ с запрошенным ключом не найден
+	ErrNotFound = errors.New("order not found")
+
+	// ErrStatusChanged — статус заказа изменили параллельно: он уже не равен ожидаемому
+	ErrStatusChanged = errors.New("order status changed concurrently")
+)
+
+// logQueryError пишет ошибку запроса query; отсутствие строки — обычный исход и пишется на уровне debug
+func logQueryError(ctx context.Context, log *slog.Logger, query string, err error) {
+	level := slog.LevelError
+
+	if errors.Is(err, sql.ErrNoRows) {
+		level = slog.LevelDebug
+	}
+
+	log.Log(ctx, level, "query failed", "query", query, "error", err)
+}
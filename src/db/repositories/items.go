@@ -2,15 +2,15 @@ package repositories
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/logger"
 	"orders/src/metrics"
-	"orders/src/myretry"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/sethvargo/go-retry"
 )
 
 type ItemRepository interface {
@@ -21,24 +21,27 @@ type ItemRepository interface {
 
 type itemRepo struct {
 	pool    *sqlx.DB
-	b       func() retry.Backoff
+	guard   *db.Guard
 	metrics *metrics.Metrics
+	log     *slog.Logger
 }
 
-func NewItemRepo(pool *sqlx.DB, metrics *metrics.Metrics) ItemRepository {
-	b := myretry.NewBackofFactory()
-	return &itemRepo{pool: pool, b: b, metrics: metrics}
+func NewItemRepo(pool *sqlx.DB, guard *db.Guard, metrics *metrics.Metrics, log *slog.Logger) ItemRepository {
+	return &itemRepo{pool: pool, guard: guard, metrics: metrics, log: logger.Component(log, "item-repo")}
 }
 
 func (repo *itemRepo) CreateItem(ctx context.Context, itemDto *models.Item) (models.Item, error) {
 	var item models.Item
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-		item, err = repo.createItem(ctx, itemDto)
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		item, err = repo.createItem(ctx, repo.pool, itemDto)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
+		if errors.Is(err, errDuplicate) {
+			repo.metrics.DuplicatesDetected.WithLabelValues("item").Inc()
+			repo.log.InfoContext(ctx, "duplicate item, returning existing", "rid", itemDto.Rid)
+
+			item, err = repo.getItemByRid(ctx, itemDto.OrderID, itemDto.Rid)
 		}
 
 		return err
@@ -47,7 +50,7 @@ func (repo *itemRepo) CreateItem(ctx context.Context, itemDto *models.Item) (mod
 	return item, err
 }
 
-func (repo *itemRepo) createItem(ctx context.Context, itemDto *models.Item) (models.Item, error) {
+func (repo *itemRepo) createItem(ctx context.Context, q sqlx.ExtContext, itemDto *models.Item) (models.Item, error) {
 	start := time.Now()
 
 	var item models.Item
@@ -55,10 +58,11 @@ func (repo *itemRepo) createItem(ctx context.Context, itemDto *models.Item) (mod
 	query := `
      INSERT INTO item (chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, order_id)
 VALUES (:chrt_id, :track_number, :price, :rid, :name, :sale, :size, :total_price, :nm_id, :brand, :status, :order_id)
+ON CONFLICT (order_id, rid) DO NOTHING
 RETURNING id, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, order_id;
     `
 
-	rows, err := repo.pool.NamedQueryContext(ctx, query, &itemDto)
+	rows, err := sqlx.NamedQueryContext(ctx, q, query, itemDto)
 
 	lat := time.Since(start).Seconds()
 	repo.metrics.DBQueryDuration.WithLabelValues("create_item", "item_service").Observe(lat)
@@ -71,11 +75,84 @@ RETURNING id, chrt_id, track_number, price, rid, name, sale, size, total_price,
 
 	defer rows.Close()
 
-	for rows.Next() {
-		if err = rows.StructScan(&item); err != nil {
-			log.Printf("Error while parsing rows %v", err)
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
 			return models.Item{}, err
 		}
+
+		return models.Item{}, errDuplicate
+	}
+
+	if err = rows.StructScan(&item); err != nil {
+		repo.log.ErrorContext(ctx, "scan row", "query", "create_item", "error", err)
+		return models.Item{}, err
+	}
+
+	return item, nil
+}
+
+func (repo *itemRepo) createItems(ctx context.Context, q sqlx.ExtContext, itemDtos []models.Item) ([]models.Item, error) {
+	start := time.Now()
+
+	n := len(itemDtos)
+	chrtIDs, prices, sales, totalPrices := make([]int64, n), make([]int64, n), make([]int64, n), make([]int64, n)
+	nmIDs, statuses, orderIDs := make([]int64, n), make([]int64, n), make([]int64, n)
+	trackNumbers, rids, names, sizes, brands := make([]string, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+
+	for i, it := range itemDtos {
+		chrtIDs[i], prices[i], sales[i], totalPrices[i] = int64(it.ChrtID), int64(it.Price), int64(it.Sale), int64(it.TotalPrice)
+		nmIDs[i], statuses[i], orderIDs[i] = int64(it.NmID), int64(it.Status), int64(it.OrderID)
+		trackNumbers[i], rids[i], names[i], sizes[i], brands[i] = it.TrackNumber, it.Rid, it.Name, it.Size, it.Brand
+	}
+
+	query := `
+     INSERT INTO item (chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, order_id)
+SELECT * FROM unnest($1::int[], $2::varchar[], $3::int[], $4::varchar[], $5::varchar[], $6::int[], $7::varchar[], $8::int[],
+$9::int[], $10::varchar[], $11::int[], $12::int[])
+ON CONFLICT (order_id, rid) DO NOTHING
+RETURNING id, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, order_id;
+    `
+
+	var items []models.Item
+
+	err := sqlx.SelectContext(ctx, q, &items, query, chrtIDs, trackNumbers, prices, rids, names, sales, sizes, totalPrices,
+		nmIDs, brands, statuses, orderIDs)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_items", "item_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_items", "item_service").Inc()
+
+		return nil, err
+	}
+
+	if len(items) < n {
+		return nil, errDuplicate
+	}
+
+	return items, nil
+}
+
+func (repo *itemRepo) getItemByRid(ctx context.Context, orderID int, rid string) (models.Item, error) {
+	start := time.Now()
+
+	var item models.Item
+
+	query := `select id, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status,
+			order_id
+			from item
+			where order_id = $1 and rid = $2;`
+
+	err := repo.pool.GetContext(ctx, &item, query, orderID, rid)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("get_item_by_rid", "item_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("get_item_by_rid", "item_service").Inc()
+
+		return models.Item{}, err
 	}
 
 	return item, nil
@@ -85,14 +162,9 @@ func (repo *itemRepo) GetItemByID(ctx context.Context, itemID int) (models.Item,
 	var item models.Item
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		item, err = repo.getItemByID(ctx, itemID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
 	})
 
@@ -117,7 +189,7 @@ func (repo *itemRepo) getItemByID(ctx context.Context, itemID int) (models.Item,
 	if err != nil {
 		repo.metrics.DBQueryErrors.WithLabelValues("get_item_by_id", "item_service").Inc()
 
-		log.Printf("Error in GetItemByID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_item_by_id", err)
 		return item, err
 	}
 
@@ -128,15 +200,10 @@ func (repo *itemRepo) GetItemsByOrderID(ctx context.Context, orderID int) ([]mod
 	var items []models.Item
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		items, err = repo.getItemsByOrderID(ctx, orderID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
-
 	})
 
 	return items, err
@@ -160,7 +227,7 @@ func (repo *itemRepo) getItemsByOrderID(ctx context.Context, orderID int) ([]mod
 	if err != nil {
 		repo.metrics.DBQueryErrors.WithLabelValues("get_item_by_order_id", "item_service").Inc()
 
-		log.Printf("Error in GetItemsByOrderID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_item_by_order_id", err)
 		return items, err
 	}
 
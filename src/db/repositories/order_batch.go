@@ -0,0 +1,211 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"orders/src/broker"
+	"orders/src/db"
+	"orders/src/db/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOrderAggregates возвращает только созданные заказы: уже сохраненные пропускаются как повторная доставка
+func (repo *orderRepo) CreateOrderAggregates(ctx context.Context, orderDtos []*broker.OrderMessage) ([]*broker.OrderMessage, error) {
+	var orders []*broker.OrderMessage
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		orders, err = repo.createOrderAggregates(ctx, orderDtos)
+
+		return err
+	})
+
+	if errors.Is(err, errDuplicate) {
+		return nil, fmt.Errorf("order batch: %w: %v", ErrConflict, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if duplicates := len(orderDtos) - len(orders); duplicates > 0 {
+		repo.metrics.DuplicatesDetected.WithLabelValues("order").Add(float64(duplicates))
+		repo.log.InfoContext(ctx, "duplicate orders in batch skipped", "duplicates", duplicates)
+	}
+
+	return orders, nil
+}
+
+func (repo *orderRepo) createOrderAggregates(ctx context.Context, orderDtos []*broker.OrderMessage) ([]*broker.OrderMessage, error) {
+	start := time.Now()
+
+	var orders []*broker.OrderMessage
+
+	err := db.WithTx(ctx, repo.pool, func(tx *sqlx.Tx) error {
+		created, err := repo.createOrders(ctx, tx, orderDtos)
+		if err != nil {
+			return fmt.Errorf("create orders: %w", err)
+		}
+
+		orders = make([]*broker.OrderMessage, 0, len(created))
+
+		var deliveries []models.Delivery
+		var payments []models.Payment
+		var items []models.Item
+
+		for _, orderDto := range orderDtos {
+			order, ok := created[orderDto.OrderUID]
+			if !ok {
+				continue
+			}
+
+			// Второй заказ с тем же order_uid в пачке — тоже повтор
+			delete(created, orderDto.OrderUID)
+
+			delivery := orderDto.Delivery
+			delivery.OrderID = order.ID
+			deliveries = append(deliveries, delivery)
+
+			payment := orderDto.Payment
+			payment.OrderID = order.ID
+			payments = append(payments, payment)
+
+			for _, item := range orderDto.Items {
+				item.OrderID = order.ID
+				items = append(items, item)
+			}
+
+			orders = append(orders, &broker.OrderMessage{Order: order})
+		}
+
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err = repo.attachChildren(ctx, tx, orders, deliveries, payments, items); err != nil {
+			return err
+		}
+
+		events := make([]models.OutboxEvent, 0, len(orders))
+
+		for _, order := range orders {
+			event, err := newOrderEvent(ctx, broker.EventOrderCreated, order.ID, order.OrderUID, order)
+			if err != nil {
+				return fmt.Errorf("build order.created: %w", err)
+			}
+
+			events = append(events, event)
+		}
+
+		if err = insertEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("insert order.created: %w", err)
+		}
+
+		return nil
+	})
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_order_aggregates", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_order_aggregates", "order_service").Inc()
+
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (repo *orderRepo) attachChildren(ctx context.Context, tx *sqlx.Tx, orders []*broker.OrderMessage,
+	deliveryDtos []models.Delivery, paymentDtos []models.Payment, itemDtos []models.Item) error {
+	byID := make(map[int]*broker.OrderMessage, len(orders))
+
+	for _, order := range orders {
+		byID[order.ID] = order
+	}
+
+	deliveries, err := repo.delivery.createDeliveries(ctx, tx, deliveryDtos)
+	if err != nil {
+		return fmt.Errorf("create deliveries: %w", err)
+	}
+
+	for _, delivery := range deliveries {
+		byID[delivery.OrderID].Delivery = delivery
+	}
+
+	payments, err := repo.payment.createPayments(ctx, tx, paymentDtos)
+	if err != nil {
+		return fmt.Errorf("create payments: %w", err)
+	}
+
+	for _, payment := range payments {
+		byID[payment.OrderID].Payment = payment
+	}
+
+	if len(itemDtos) == 0 {
+		return nil
+	}
+
+	items, err := repo.item.createItems(ctx, tx, itemDtos)
+	if err != nil {
+		return fmt.Errorf("create items: %w", err)
+	}
+
+	for _, item := range items {
+		order := byID[item.OrderID]
+		order.Items = append(order.Items, item)
+	}
+
+	return nil
+}
+
+func (repo *orderRepo) createOrders(ctx context.Context, q sqlx.ExtContext, orderDtos []*broker.OrderMessage) (map[string]models.Order, error) {
+	start := time.Now()
+
+	n := len(orderDtos)
+	uids, trackNumbers, entries, locales := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	signatures, customerIDs, deliveryServices := make([]string, n), make([]string, n), make([]string, n)
+	shardkeys, oofShards, smIDs, datesCreated := make([]string, n), make([]string, n), make([]int64, n), make([]time.Time, n)
+
+	for i, dto := range orderDtos {
+		o := dto.Order
+		uids[i], trackNumbers[i], entries[i], locales[i] = o.OrderUID, o.TrackNumber, o.Entry, o.Locale
+		signatures[i], customerIDs[i], deliveryServices[i] = o.InternalSignature, o.CustomerID, o.DeliveryService
+		shardkeys[i], oofShards[i], smIDs[i], datesCreated[i] = o.Shardkey, o.OofShard, int64(o.SmID), o.DateCreated
+	}
+
+	query := `
+    INSERT INTO "order" (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created,
+	oof_shard)
+	SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::varchar[], $5::varchar[], $6::varchar[], $7::varchar[], $8::varchar[],
+	$9::int[], $10::timestamp[], $11::varchar[])
+	ON CONFLICT (order_uid) DO NOTHING
+	RETURNING id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created,
+	oof_shard, status;
+    `
+
+	var rows []models.Order
+
+	err := sqlx.SelectContext(ctx, q, &rows, query, uids, trackNumbers, entries, locales, signatures, customerIDs, deliveryServices,
+		shardkeys, smIDs, datesCreated, oofShards)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_orders", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_orders", "order_service").Inc()
+
+		return nil, err
+	}
+
+	created := make(map[string]models.Order, len(rows))
+
+	for _, order := range rows {
+		created[order.OrderUID] = order
+	}
+
+	return created, nil
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"orders/src/broker"
+	"orders/src/db/models"
+)
+
+// arrayConverter пропускает срезы в sqlmock как есть: массивы для unnest кодирует драйвер pgx
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	switch v.(type) {
+	case []string, []int64, []time.Time:
+		return v, nil
+	}
+
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func newBatchOrder(uid, transaction string, rids ...string) *broker.OrderMessage {
+	order := &broker.OrderMessage{
+		Order:    models.Order{OrderUID: uid, TrackNumber: "WBILMTESTTRACK", DateCreated: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)},
+		Delivery: models.Delivery{Name: "Ivan"},
+		Payment:  models.Payment{Transaction: transaction},
+	}
+
+	for _, rid := range rids {
+		order.Items = append(order.Items, models.Item{Rid: rid})
+	}
+
+	return order
+}
+
+var (
+	orderBatchColumns    = []string{"id", "order_uid", "track_number", "date_created", "status"}
+	deliveryBatchColumns = []string{"id", "name", "order_id"}
+	paymentBatchColumns  = []string{"id", "transaction", "order_id"}
+	itemBatchColumns     = []string{"id", "rid", "order_id"}
+)
+
+func TestCreateOrderAggregates_SkipsDuplicates(t *testing.T) {
+	mock, repo := newTestOrderRepo(t)
+
+	dated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	// uid-2 уже сохранен: ON CONFLICT DO NOTHING его не возвращает
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO "order" .*SELECT \* FROM unnest\(.*ON CONFLICT \(order_uid\) DO NOTHING.*RETURNING`).
+		WithArgs([]string{"uid-1", "uid-2", "uid-3"}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(orderBatchColumns).
+			AddRow(11, "uid-1", "WBILMTESTTRACK", dated, "created").
+			AddRow(13, "uid-3", "WBILMTESTTRACK", dated, "created"))
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO delivery .*unnest\(`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), []int64{11, 13}).
+		WillReturnRows(sqlmock.NewRows(deliveryBatchColumns).AddRow(21, "Ivan", 11).AddRow(23, "Ivan", 13))
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO payment .*unnest\(`).
+		WillReturnRows(sqlmock.NewRows(paymentBatchColumns).AddRow(31, "t-1", 11).AddRow(33, "t-3", 13))
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO item .*unnest\(.*ON CONFLICT \(order_id, rid\) DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows(itemBatchColumns).AddRow(41, "r-1a", 11).AddRow(42, "r-1b", 11).AddRow(43, "r-3", 13))
+	mock.ExpectExec(`(?s)^\s*INSERT INTO outbox .*unnest\(`).
+		WithArgs([]int64{11, 13}, sqlmock.AnyArg(), []string{"uid-1", "uid-3"}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	orders, err := repo.CreateOrderAggregates(context.Background(), []*broker.OrderMessage{
+		newBatchOrder("uid-1", "t-1", "r-1a", "r-1b"),
+		newBatchOrder("uid-2", "t-2", "r-2"),
+		newBatchOrder("uid-3", "t-3", "r-3"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, orders, 2)
+	require.Equal(t, 11, orders[0].ID)
+	require.Equal(t, 21, orders[0].Delivery.ID)
+	require.Equal(t, 31, orders[0].Payment.ID)
+	require.Len(t, orders[0].Items, 2)
+	require.Equal(t, 13, orders[1].ID)
+	require.Equal(t, 33, orders[1].Payment.ID)
+	require.Equal(t, []models.Item{{ID: 43, Rid: "r-3", OrderID: 13}}, orders[1].Items)
+}
+
+func TestCreateOrderAggregates_ChildConflictRollsBack(t *testing.T) {
+	mock, repo := newTestOrderRepo(t)
+
+	dated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO "order" `).
+		WillReturnRows(sqlmock.NewRows(orderBatchColumns).
+			AddRow(11, "uid-1", "WBILMTESTTRACK", dated, "created").
+			AddRow(12, "uid-2", "WBILMTESTTRACK", dated, "created"))
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO delivery `).
+		WillReturnRows(sqlmock.NewRows(deliveryBatchColumns).AddRow(21, "Ivan", 11).AddRow(22, "Ivan", 12))
+	// transaction второй оплаты занят другим заказом
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO payment `).
+		WillReturnRows(sqlmock.NewRows(paymentBatchColumns).AddRow(31, "t-1", 11))
+	mock.ExpectRollback()
+
+	_, err := repo.CreateOrderAggregates(context.Background(), []*broker.OrderMessage{
+		newBatchOrder("uid-1", "t-1"),
+		newBatchOrder("uid-2", "t-taken"),
+	})
+	require.ErrorIs(t, err, ErrConflict)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderCursor — позиция keyset-пагинации по (date_created, id), заказы идут от новых к старым
+type OrderCursor struct {
+	DateCreated time.Time
+	ID          int
+}
+
+var errBadCursor = errors.New("malformed cursor")
+
+// Encode упаковывает курсор в непрозрачную строку для клиента
+func (c OrderCursor) Encode() string {
+	raw := strconv.FormatInt(c.DateCreated.UnixNano(), 10) + ":" + strconv.Itoa(c.ID)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeOrderCursor разбирает строку из Encode; пустая строка — первая страница
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errBadCursor
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, errBadCursor
+	}
+
+	orderID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, errBadCursor
+	}
+
+	return &OrderCursor{DateCreated: time.Unix(0, unixNano).UTC(), ID: orderID}, nil
+}
+
+// OrderFilter — фильтры списка заказов. Незаполненные поля не фильтруют
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Locale          string
+	DateFrom        time.Time
+	DateTo          time.Time
+
+	// Оплата
+	Currency string
+	Provider string
+
+	// Заказ содержит товар с такими nm_id и/или brand
+	NmID  int
+	Brand string
+
+	After *OrderCursor
+	Limit int
+}
+
+// where собирает условие WHERE и аргументы для запроса с алиасами o (order) и p (payment)
+func (f OrderFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.CustomerID != "" {
+		conds = append(conds, "o.customer_id = "+arg(f.CustomerID))
+	}
+
+	if f.TrackNumber != "" {
+		conds = append(conds, "o.track_number = "+arg(f.TrackNumber))
+	}
+
+	if f.DeliveryService != "" {
+		conds = append(conds, "o.delivery_service = "+arg(f.DeliveryService))
+	}
+
+	if f.Locale != "" {
+		conds = append(conds, "o.locale = "+arg(f.Locale))
+	}
+
+	if !f.DateFrom.IsZero() {
+		conds = append(conds, "o.date_created >= "+arg(f.DateFrom))
+	}
+
+	if !f.DateTo.IsZero() {
+		conds = append(conds, "o.date_created < "+arg(f.DateTo))
+	}
+
+	if f.Currency != "" {
+		conds = append(conds, "p.currency = "+arg(f.Currency))
+	}
+
+	if f.Provider != "" {
+		conds = append(conds, "p.provider = "+arg(f.Provider))
+	}
+
+	if f.NmID != 0 || f.Brand != "" {
+		var itemConds []string
+
+		if f.NmID != 0 {
+			itemConds = append(itemConds, "i.nm_id = "+arg(f.NmID))
+		}
+
+		if f.Brand != "" {
+			itemConds = append(itemConds, "i.brand = "+arg(f.Brand))
+		}
+
+		conds = append(conds, "EXISTS (SELECT 1 FROM item i WHERE i.order_id = o.id AND "+strings.Join(itemConds, " AND ")+")")
+	}
+
+	if f.After != nil {
+		conds = append(conds, fmt.Sprintf("(o.date_created, o.id) < (%s, %s)", arg(f.After.DateCreated), arg(f.After.ID)))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
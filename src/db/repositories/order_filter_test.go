@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderCursor_RoundTrip(t *testing.T) {
+	cursor := OrderCursor{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.UTC), ID: 42}
+
+	decoded, err := DecodeOrderCursor(cursor.Encode())
+	require.NoError(t, err)
+	require.Equal(t, cursor, *decoded)
+
+	empty, err := DecodeOrderCursor("")
+	require.NoError(t, err)
+	require.Nil(t, empty)
+
+	_, err = DecodeOrderCursor("not-a-cursor")
+	require.Error(t, err)
+}
+
+func TestOrderFilter_Where(t *testing.T) {
+	after := &OrderCursor{DateCreated: time.Unix(100, 0).UTC(), ID: 7}
+
+	where, args := OrderFilter{
+		CustomerID: "test",
+		Currency:   "USD",
+		NmID:       2389212,
+		Brand:      "Vivienne Sabo",
+		After:      after,
+	}.where()
+
+	require.Equal(t, "o.customer_id = $1 AND p.currency = $2 AND "+
+		"EXISTS (SELECT 1 FROM item i WHERE i.order_id = o.id AND i.nm_id = $3 AND i.brand = $4) AND "+
+		"(o.date_created, o.id) < ($5, $6)", where)
+	require.Equal(t, []interface{}{"test", "USD", 2389212, "Vivienne Sabo", after.DateCreated, 7}, args)
+
+	where, args = OrderFilter{}.where()
+	require.Empty(t, where)
+	require.Empty(t, args)
+}
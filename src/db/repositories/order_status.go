@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"orders/src/broker"
+	"orders/src/db"
+	"orders/src/db/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UpdateStatus меняет статус, только если он все еще равен change.From; иначе ErrStatusChanged
+func (repo *orderRepo) UpdateStatus(ctx context.Context, change *models.StatusChange) (models.StatusChange, error) {
+	var saved models.StatusChange
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		saved, err = repo.updateStatus(ctx, change)
+
+		return err
+	})
+
+	return saved, err
+}
+
+func (repo *orderRepo) updateStatus(ctx context.Context, change *models.StatusChange) (models.StatusChange, error) {
+	start := time.Now()
+
+	var saved models.StatusChange
+
+	err := db.WithTx(ctx, repo.pool, func(tx *sqlx.Tx) error {
+		var orderUID string
+
+		err := tx.GetContext(ctx, &orderUID, `UPDATE "order" SET status = $3 WHERE id = $1 AND status = $2 RETURNING order_uid;`,
+			change.OrderID, change.From, change.To)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return repo.statusMismatch(ctx, tx, change.OrderID)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason)
+		VALUES (:order_id, :from_status, :to_status, :actor, :reason)
+		RETURNING id, order_id, from_status, to_status, actor, reason, created_at;`
+
+		rows, err := sqlx.NamedQueryContext(ctx, tx, query, change)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return err
+			}
+
+			return sql.ErrNoRows
+		}
+
+		if err = rows.StructScan(&saved); err != nil {
+			return err
+		}
+
+		if err = rows.Close(); err != nil {
+			return err
+		}
+
+		event, err := newOrderEvent(ctx, broker.EventOrderStatusChanged, saved.OrderID, orderUID, saved)
+		if err != nil {
+			return fmt.Errorf("build order.status_changed: %w", err)
+		}
+
+		return insertEvent(ctx, tx, event)
+	})
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("update_order_status", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("update_order_status", "order_service").Inc()
+
+		return models.StatusChange{}, err
+	}
+
+	return saved, nil
+}
+
+func (repo *orderRepo) statusMismatch(ctx context.Context, q sqlx.QueryerContext, orderID int) error {
+	var exists bool
+
+	if err := sqlx.GetContext(ctx, q, &exists, `SELECT EXISTS (SELECT 1 FROM "order" WHERE id = $1);`, orderID); err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrStatusChanged
+}
+
+// GetStatusHistory читает статус под FOR SHARE, чтобы смена статуса не закоммитилась между ним и историей
+func (repo *orderRepo) GetStatusHistory(ctx context.Context, orderID int) (models.OrderStatus, []models.StatusChange, error) {
+	var status models.OrderStatus
+	var history []models.StatusChange
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		status, history, err = repo.getStatusHistory(ctx, orderID)
+
+		return err
+	})
+
+	return status, history, err
+}
+
+func (repo *orderRepo) getStatusHistory(ctx context.Context, orderID int) (models.OrderStatus, []models.StatusChange, error) {
+	start := time.Now()
+
+	var status models.OrderStatus
+
+	history := []models.StatusChange{}
+
+	err := db.WithTx(ctx, repo.pool, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &status, `SELECT status FROM "order" WHERE id = $1 FOR SHARE;`, orderID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		query := `SELECT id, order_id, from_status, to_status, actor, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id;`
+
+		return tx.SelectContext(ctx, &history, query, orderID)
+	})
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("get_order_status_history", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("get_order_status_history", "order_service").Inc()
+
+		return "", nil, err
+	}
+
+	return status, history, nil
+}
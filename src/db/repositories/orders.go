@@ -2,34 +2,54 @@ package repositories
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"orders/src/broker"
 	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/logger"
 	"orders/src/metrics"
-	"orders/src/myretry"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/sethvargo/go-retry"
 )
 
 type OrderRepository interface {
 	CreateOrder(ctx context.Context, orderDto *models.Order) (models.Order, error)
+	CreateOrderAggregate(ctx context.Context, orderDto *broker.OrderMessage) (*broker.OrderMessage, error)
+	CreateOrderAggregates(ctx context.Context, orderDtos []*broker.OrderMessage) ([]*broker.OrderMessage, error)
 	GetOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error)
+	GetOrderByUID(ctx context.Context, orderUID string) (*broker.OrderMessage, error)
+	ListOrders(ctx context.Context, filter OrderFilter) ([]*broker.OrderMessage, error)
+	UpdateStatus(ctx context.Context, change *models.StatusChange) (models.StatusChange, error)
+	GetStatusHistory(ctx context.Context, orderID int) (models.OrderStatus, []models.StatusChange, error)
 }
 
 type orderRepo struct {
 	pool    *sqlx.DB
-	b       func() retry.Backoff
+	guard   *db.Guard
 	metrics *metrics.Metrics
+	log     *slog.Logger
+
+	// Репозитории дочерних сущностей для записи агрегата в одной транзакции
+	delivery *deliveryRepo
+	payment  *paymentRepo
+	item     *itemRepo
 }
 
-func NewOrderRepo(pool *sqlx.DB, metrics *metrics.Metrics) OrderRepository {
-	b := myretry.NewBackofFactory()
-	return &orderRepo{pool: pool, b: b, metrics: metrics}
+func NewOrderRepo(pool *sqlx.DB, guard *db.Guard, metrics *metrics.Metrics, log *slog.Logger) OrderRepository {
+	log = logger.Component(log, "order-repo")
+
+	return &orderRepo{
+		pool:     pool,
+		guard:    guard,
+		metrics:  metrics,
+		log:      log,
+		delivery: &deliveryRepo{pool: pool, guard: guard, metrics: metrics, log: log},
+		payment:  &paymentRepo{pool: pool, guard: guard, metrics: metrics, log: log},
+		item:     &itemRepo{pool: pool, guard: guard, metrics: metrics, log: log},
+	}
 }
 
 func (repo *orderRepo) CreateOrder(ctx context.Context, orderDto *models.Order) (models.Order, error) {
@@ -37,12 +57,15 @@ func (repo *orderRepo) CreateOrder(ctx context.Context, orderDto *models.Order)
 	var order models.Order
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
+	// Чтение сохраненного заказа при повторе идет через тот же guard, что и запись
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		order, err = repo.createOrder(ctx, repo.pool, orderDto)
 
-		order, err = repo.createOrder(ctx, orderDto)
+		if errors.Is(err, errDuplicate) {
+			repo.metrics.DuplicatesDetected.WithLabelValues("order").Inc()
+			repo.log.InfoContext(ctx, "duplicate order, returning existing")
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
+			order, err = repo.getOrderRowByUID(ctx, orderDto.OrderUID)
 		}
 
 		return err
@@ -51,7 +74,7 @@ func (repo *orderRepo) CreateOrder(ctx context.Context, orderDto *models.Order)
 	return order, err
 }
 
-func (repo *orderRepo) createOrder(ctx context.Context, orderDto *models.Order) (models.Order, error) {
+func (repo *orderRepo) createOrder(ctx context.Context, q sqlx.ExtContext, orderDto *models.Order) (models.Order, error) {
 
 	start := time.Now()
 
@@ -59,14 +82,15 @@ func (repo *orderRepo) createOrder(ctx context.Context, orderDto *models.Order)
 
 	query := `
     INSERT INTO "order" (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created,
-	oof_shard, delivery_id, payment_id)
+	oof_shard)
 	VALUES (:order_uid, :track_number, :entry, :locale, :internal_signature, :customer_id, :delivery_service, :shardkey, :sm_id, :date_created,
-	:oof_shard, :delivery_id, :payment_id)
+	:oof_shard)
+	ON CONFLICT (order_uid) DO NOTHING
 	RETURNING id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created,
-	oof_shard, delivery_id, payment_id;
+	oof_shard, status;
     `
 
-	rows, err := repo.pool.NamedQueryContext(ctx, query, orderDto)
+	rows, err := sqlx.NamedQueryContext(ctx, q, query, orderDto)
 
 	lat := time.Since(start).Seconds()
 	repo.metrics.DBQueryDuration.WithLabelValues("create_order", "order_service").Observe(lat)
@@ -79,26 +103,55 @@ func (repo *orderRepo) createOrder(ctx context.Context, orderDto *models.Order)
 
 	defer rows.Close()
 
-	for rows.Next() {
-		if err = rows.StructScan(&order); err != nil {
-			log.Printf("Error while parsing rows %v", err)
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
 			return models.Order{}, err
 		}
+
+		return models.Order{}, errDuplicate
+	}
+
+	if err = rows.StructScan(&order); err != nil {
+		repo.log.ErrorContext(ctx, "scan row", "query", "create_order", "error", err)
+		return models.Order{}, err
 	}
 
 	return order, nil
 }
 
-func (repo *orderRepo) GetOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error) {
+func (repo *orderRepo) getOrderRowByUID(ctx context.Context, orderUID string) (models.Order, error) {
+	start := time.Now()
+
+	var order models.Order
+
+	query := `select id, order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+			shardkey, sm_id, date_created, oof_shard, status
+			from "order"
+			where order_uid = $1;`
+
+	err := repo.pool.GetContext(ctx, &order, query, orderUID)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("get_order_by_uid", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("get_order_by_uid", "order_service").Inc()
+
+		return models.Order{}, err
+	}
+
+	return order, nil
+}
+
+func (repo *orderRepo) CreateOrderAggregate(ctx context.Context, orderDto *broker.OrderMessage) (*broker.OrderMessage, error) {
 	var order *broker.OrderMessage
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		order, err = repo.createOrderAggregate(ctx, orderDto)
 
-		order, err = repo.getOrderByID(ctx, orderID)
-
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
+		if errors.Is(err, errDuplicate) {
+			order, err = repo.resolveDuplicate(ctx, orderDto, err)
 		}
 
 		return err
@@ -107,212 +160,255 @@ func (repo *orderRepo) GetOrderByID(ctx context.Context, orderID int) (*broker.O
 	return order, err
 }
 
-func (repo *orderRepo) getOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error) {
+// resolveDuplicate: сохраненный заказ с таким order_uid — повторная доставка, иначе ключ занят другим заказом
+func (repo *orderRepo) resolveDuplicate(ctx context.Context, orderDto *broker.OrderMessage, cause error) (*broker.OrderMessage, error) {
+	existing, err := repo.getOrderBy(ctx, "get_order_by_uid", "o.order_uid", orderDto.OrderUID)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("order %s: %w: %v", orderDto.OrderUID, ErrConflict, cause)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo.metrics.DuplicatesDetected.WithLabelValues("order").Inc()
+	repo.log.InfoContext(ctx, "duplicate order, returning existing", "order_id", existing.ID)
+
+	return existing, nil
+}
+
+// createOrderAggregate пишет заказ первым: дочерние записи ссылаются на него через order_id
+func (repo *orderRepo) createOrderAggregate(ctx context.Context, orderDto *broker.OrderMessage) (*broker.OrderMessage, error) {
 	start := time.Now()
 
-	type orderRow struct {
-		// Order
-		OrderID           int       `db:"order_id"`
-		OrderUID          string    `db:"order_order_uid"`
-		TrackNumber       string    `db:"order_track_number"`
-		Entry             string    `db:"order_entry"`
-		Locale            string    `db:"order_locale"`
-		InternalSignature string    `db:"order_internal_signature"`
-		CustomerID        string    `db:"order_customer_id"`
-		OrderDeliveryID   int       `db:"order_delivery_id"`
-		OrderPaymentID    int       `db:"order_payment_id"`
-		Shardkey          string    `db:"order_shardkey"`
-		SmID              int       `db:"order_sm_id"`
-		DateCreated       time.Time `db:"order_date_created"`
-		OofShard          string    `db:"order_oof_shard"`
-
-		// Payment
-		PaymentID    sql.NullInt64  `db:"payment_id"`
-		Transaction  sql.NullString `db:"payment_transaction"`
-		RequestID    sql.NullString `db:"payment_request_id"`
-		Currency     sql.NullString `db:"payment_currency"`
-		Provider     sql.NullString `db:"payment_provider"`
-		Amount       sql.NullInt64  `db:"payment_amount"`
-		PaymentDt    sql.NullInt64  `db:"payment_payment_dt"`
-		Bank         sql.NullString `db:"payment_bank"`
-		DeliveryCost sql.NullInt64  `db:"payment_delivery_cost"`
-		GoodsTotal   sql.NullInt64  `db:"payment_goods_total"`
-		CustomFee    sql.NullInt64  `db:"payment_custom_fee"`
-
-		// Delivery
-		DeliveryID   sql.NullInt64  `db:"delivery_id"`
-		DeliveryName sql.NullString `db:"delivery_name"`
-		Phone        sql.NullString `db:"delivery_phone"`
-		Zip          sql.NullString `db:"delivery_zip"`
-		City         sql.NullString `db:"delivery_city"`
-		Address      sql.NullString `db:"delivery_address"`
-		Region       sql.NullString `db:"delivery_region"`
-		Email        sql.NullString `db:"delivery_email"`
-
-		// Item
-		ItemID          sql.NullInt64  `db:"item_id"`
-		ChrtID          sql.NullInt64  `db:"item_chrt_id"`
-		ItemTrackNumber sql.NullString `db:"item_track_number"`
-		Price           sql.NullInt64  `db:"item_price"`
-		Rid             sql.NullString `db:"item_rid"`
-		Name            sql.NullString `db:"item_name"`
-		Sale            sql.NullInt64  `db:"item_sale"`
-		Size            sql.NullString `db:"item_size"`
-		TotalPrice      sql.NullInt64  `db:"item_total_price"`
-		NmID            sql.NullInt64  `db:"item_nm_id"`
-		Brand           sql.NullString `db:"item_brand"`
-		Status          sql.NullInt64  `db:"item_status"`
-		ItemOrderID     sql.NullInt64  `db:"item_order_id"`
+	var order *broker.OrderMessage
+
+	err := db.WithTx(ctx, repo.pool, func(tx *sqlx.Tx) error {
+		created, err := repo.createOrder(ctx, tx, &orderDto.Order)
+		if err != nil {
+			return fmt.Errorf("create order: %w", err)
+		}
+
+		deliveryDto := orderDto.Delivery
+		deliveryDto.OrderID = created.ID
+
+		delivery, err := repo.delivery.createDelivery(ctx, tx, &deliveryDto)
+		if err != nil {
+			return fmt.Errorf("create delivery: %w", err)
+		}
+
+		paymentDto := orderDto.Payment
+		paymentDto.OrderID = created.ID
+
+		payment, err := repo.payment.createPayment(ctx, tx, &paymentDto)
+		if err != nil {
+			return fmt.Errorf("create payment: %w", err)
+		}
+
+		items := make([]models.Item, 0, len(orderDto.Items))
+
+		for _, itemDto := range orderDto.Items {
+			itemDto.OrderID = created.ID
+
+			item, err := repo.item.createItem(ctx, tx, &itemDto)
+			if err != nil {
+				return fmt.Errorf("create item %s: %w", itemDto.Rid, err)
+			}
+
+			items = append(items, item)
+		}
+
+		order = &broker.OrderMessage{
+			Order:    created,
+			Delivery: delivery,
+			Payment:  payment,
+			Items:    items,
+		}
+
+		event, err := newOrderEvent(ctx, broker.EventOrderCreated, created.ID, created.OrderUID, order)
+		if err != nil {
+			return fmt.Errorf("build order.created: %w", err)
+		}
+
+		if err = insertEvent(ctx, tx, event); err != nil {
+			return fmt.Errorf("insert order.created: %w", err)
+		}
+
+		return nil
+	})
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_order_aggregate", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_order_aggregate", "order_service").Inc()
+
+		return nil, err
 	}
 
-	query := `SELECT
-        o.id AS order_id,
-        o.order_uid AS order_order_uid,
-        o.track_number AS order_track_number,
-        o.entry AS order_entry,
-        o.locale AS order_locale,
-        o.internal_signature AS order_internal_signature,
-        o.customer_id AS order_customer_id,
-        o.delivery_id AS order_delivery_id,
-        o.payment_id AS order_payment_id,
-        o.shardkey AS order_shardkey,
-        o.sm_id AS order_sm_id,
-        o.date_created AS order_date_created,
-        o.oof_shard AS order_oof_shard,
-
-        p.id AS payment_id,
-        p.transaction AS payment_transaction,
-        p.request_id AS payment_request_id,
-        p.currency AS payment_currency,
-        p.provider AS payment_provider,
-        p.amount AS payment_amount,
-        p.payment_dt AS payment_payment_dt,
-        p.bank AS payment_bank,
-        p.delivery_cost AS payment_delivery_cost,
-        p.goods_total AS payment_goods_total,
-        p.custom_fee AS payment_custom_fee,
-
-        d.id AS delivery_id,
-        d.name AS delivery_name,
-        d.phone AS delivery_phone,
-        d.zip AS delivery_zip,
-        d.city AS delivery_city,
-        d.address AS delivery_address,
-        d.region AS delivery_region,
-        d.email AS delivery_email,
-
-        i.id AS item_id,
-        i.chrt_id AS item_chrt_id,
-        i.track_number AS item_track_number,
-        i.price AS item_price,
-        i.rid AS item_rid,
-        i.name AS item_name,
-        i.sale AS item_sale,
-        i.size AS item_size,
-        i.total_price AS item_total_price,
-        i.nm_id AS item_nm_id,
-        i.brand AS item_brand,
-        i.status AS item_status,
-        i.order_id AS item_order_id
-    FROM "order" o
-    LEFT JOIN payment p ON o.payment_id = p.id
-    LEFT JOIN delivery d ON o.delivery_id = d.id
+	return order, nil
+}
+
+func (repo *orderRepo) GetOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error) {
+	var order *broker.OrderMessage
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		order, err = repo.getOrderByID(ctx, orderID)
+
+		return err
+	})
+
+	return order, err
+}
+
+func (repo *orderRepo) getOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error) {
+	return repo.getOrderBy(ctx, "get_order_by_id", "o.id", orderID)
+}
+
+func (repo *orderRepo) GetOrderByUID(ctx context.Context, orderUID string) (*broker.OrderMessage, error) {
+	var order *broker.OrderMessage
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		order, err = repo.getOrderBy(ctx, "get_order_by_uid", "o.order_uid", orderUID)
+
+		return err
+	})
+
+	return order, err
+}
+
+// getOrderBy: column — только константы из кода репозитория, не пользовательский ввод
+func (repo *orderRepo) getOrderBy(ctx context.Context, queryName string, column string, value interface{}) (*broker.OrderMessage, error) {
+	start := time.Now()
+
+	query := `SELECT ` + orderColumns + `,
+        ` + itemColumns + `
+    ` + orderJoins + `
     LEFT JOIN item i ON i.order_id = o.id
-    WHERE o.id = $1
+    WHERE ` + column + ` = $1
     ORDER BY i.id;`
 
 	var rows []orderRow
-	err := repo.pool.SelectContext(ctx, &rows, query, orderID)
+	err := repo.pool.SelectContext(ctx, &rows, query, value)
 
 	lat := time.Since(start).Seconds()
-	repo.metrics.DBQueryDuration.WithLabelValues("get_order_by_id", "order_service").Observe(lat)
+	repo.metrics.DBQueryDuration.WithLabelValues(queryName, "order_service").Observe(lat)
 
 	if err != nil {
-		repo.metrics.DBQueryErrors.WithLabelValues("get_order_by_id", "order_service").Inc()
+		repo.metrics.DBQueryErrors.WithLabelValues(queryName, "order_service").Inc()
 		return nil, err
 	}
 
 	if len(rows) == 0 {
-		return nil, fmt.Errorf("order not found")
+		return nil, ErrNotFound
 	}
 
-	r := rows[0]
-
-	scanPayment := func(r orderRow) models.Payment {
-		return models.Payment{
-			ID:           int(r.PaymentID.Int64),
-			Transaction:  r.Transaction.String,
-			RequestID:    r.RequestID.String,
-			Currency:     r.Currency.String,
-			Provider:     r.Provider.String,
-			Amount:       int(r.Amount.Int64),
-			PaymentDt:    int(r.PaymentDt.Int64),
-			Bank:         r.Bank.String,
-			DeliveryCost: int(r.DeliveryCost.Int64),
-			GoodsTotal:   int(r.GoodsTotal.Int64),
-			CustomFee:    int(r.CustomFee.Int64),
-			OrderID:      r.OrderPaymentID,
+	order := rows[0].message()
+
+	for _, r := range rows {
+		if r.ItemID.Valid {
+			order.Items = append(order.Items, r.item())
 		}
 	}
 
-	scanDelivery := func(r orderRow) models.Delivery {
-		return models.Delivery{
-			ID:      int(r.DeliveryID.Int64),
-			Name:    r.DeliveryName.String,
-			Phone:   r.Phone.String,
-			Zip:     r.Zip.String,
-			City:    r.City.String,
-			Address: r.Address.String,
-			Region:  r.Region.String,
-			Email:   r.Email.String,
-			OrderID: r.OrderDeliveryID,
-		}
+	return order, nil
+}
+
+func (repo *orderRepo) ListOrders(ctx context.Context, filter OrderFilter) ([]*broker.OrderMessage, error) {
+	var orders []*broker.OrderMessage
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		orders, err = repo.listOrders(ctx, filter)
+
+		return err
+	})
+
+	return orders, err
+}
+
+// listOrders догружает товары всей страницы вторым запросом, а не запросом на каждый заказ
+func (repo *orderRepo) listOrders(ctx context.Context, filter OrderFilter) ([]*broker.OrderMessage, error) {
+	start := time.Now()
+
+	where, args := filter.where()
+
+	query := `SELECT ` + orderColumns + `
+    ` + orderJoins
+
+	if where != "" {
+		query += `
+    WHERE ` + where
 	}
 
-	scanItem := func(r orderRow) models.Item {
-		return models.Item{
-			ID:          int(r.ItemID.Int64),
-			ChrtID:      int(r.ChrtID.Int64),
-			TrackNumber: r.ItemTrackNumber.String,
-			Price:       int(r.Price.Int64),
-			Rid:         r.Rid.String,
-			Name:        r.Name.String,
-			Sale:        int(r.Sale.Int64),
-			Size:        r.Size.String,
-			TotalPrice:  int(r.TotalPrice.Int64),
-			NmID:        int(r.NmID.Int64),
-			Brand:       r.Brand.String,
-			Status:      int(r.Status.Int64),
-			OrderID:     int(r.ItemOrderID.Int64),
-		}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(`
+    ORDER BY o.date_created DESC, o.id DESC
+    LIMIT $%d;`, len(args))
+
+	var rows []orderRow
+	err := repo.pool.SelectContext(ctx, &rows, query, args...)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("list_orders", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("list_orders", "order_service").Inc()
+		return nil, err
+	}
+
+	orders := make([]*broker.OrderMessage, 0, len(rows))
+
+	for _, r := range rows {
+		orders = append(orders, r.message())
+	}
+
+	if err = repo.attachItems(ctx, orders); err != nil {
+		return nil, err
 	}
 
-	order := &broker.OrderMessage{
-		Order: models.Order{
-			ID:                r.OrderID,
-			OrderUID:          r.OrderUID,
-			TrackNumber:       r.TrackNumber,
-			Entry:             r.Entry,
-			Locale:            r.Locale,
-			InternalSignature: r.InternalSignature,
-			CustomerID:        r.CustomerID,
-			DeliveryID:        r.OrderDeliveryID,
-			PaymentID:         r.OrderPaymentID,
-			Shardkey:          r.Shardkey,
-			SmID:              r.SmID,
-			DateCreated:       r.DateCreated,
-			OofShard:          r.OofShard,
-		},
-		Payment:  scanPayment(r),
-		Delivery: scanDelivery(r),
-		Items:    []models.Item{},
+	return orders, nil
+}
+
+func (repo *orderRepo) attachItems(ctx context.Context, orders []*broker.OrderMessage) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	byID := make(map[int]*broker.OrderMessage, len(orders))
+	ids := make([]int64, 0, len(orders))
+
+	for _, order := range orders {
+		byID[order.ID] = order
+		ids = append(ids, int64(order.ID))
+	}
+
+	query := `SELECT ` + itemColumns + `
+    FROM item i
+    WHERE i.order_id = ANY($1)
+    ORDER BY i.order_id, i.id;`
+
+	var rows []orderRow
+	err := repo.pool.SelectContext(ctx, &rows, query, ids)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("get_items_by_order_ids", "order_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("get_items_by_order_ids", "order_service").Inc()
+		return err
 	}
 
 	for _, r := range rows {
-		if r.ItemID.Valid {
-			order.Items = append(order.Items, scanItem(r))
+		if order, ok := byID[int(r.ItemOrderID.Int64)]; ok {
+			order.Items = append(order.Items, r.item())
 		}
 	}
 
-	return order, nil
+	return nil
 }
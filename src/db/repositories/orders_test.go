@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"orders/src/broker"
+	"orders/src/config"
+	"orders/src/db"
+	"orders/src/db/models"
+	"orders/src/logger"
+	"orders/src/metrics"
+)
+
+func newTestOrderRepo(t *testing.T) (sqlmock.Sqlmock, OrderRepository) {
+	mock, repo, _ := newTestOrderRepoWithMetrics(t)
+	return mock, repo
+}
+
+func newTestOrderRepoWithMetrics(t *testing.T) (sqlmock.Sqlmock, OrderRepository, *metrics.Metrics) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp), sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	m := &metrics.Metrics{
+		DBQueryDuration:     prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_db_query_duration_seconds"}, []string{"query", "service"}),
+		DBQueryErrors:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_db_query_errors_total"}, []string{"query", "service"}),
+		DBGuardRejections:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_db_guard_rejections_total"}, []string{"reason"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_circuit_breaker_state"}, []string{"name"}),
+		DuplicatesDetected:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_duplicates_detected_total"}, []string{"entity"}),
+	}
+
+	return mock, NewOrderRepo(sqlx.NewDb(conn, "sqlmock"), db.NewGuard(config.Default().DB, m, logger.Discard()), m, logger.Discard()), m
+}
+
+func TestCreateOrderAggregate_RollsBackOnChildFailure(t *testing.T) {
+	mock, repo := newTestOrderRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO "order" `).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_uid"}).AddRow(11, "uid-1"))
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO delivery `).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "order_id"}).AddRow(21, "Ivan", 11))
+	// Заказ и доставка уже вставлены, но падает оплата: откатывается весь агрегат
+	mock.ExpectQuery(`(?s)^\s*INSERT INTO payment `).
+		WillReturnError(errors.New(`new row for relation "payment" violates check constraint "payment_amount_check"`))
+	mock.ExpectRollback()
+
+	_, err := repo.CreateOrderAggregate(context.Background(), &broker.OrderMessage{
+		Order:    models.Order{OrderUID: "uid-1"},
+		Delivery: models.Delivery{Name: "Ivan"},
+		Payment:  models.Payment{Transaction: "t-1"},
+		Items:    []models.Item{{Rid: "r-1"}},
+	})
+	require.ErrorContains(t, err, "create payment")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectAggregateUntil ожидает запись агрегата uid-1 до вставки table включительно; table ничего не вставляет
+func expectAggregateUntil(mock sqlmock.Sqlmock, table string) {
+	dated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+
+	inserts := []struct {
+		table string
+		rows  *sqlmock.Rows
+	}{
+		{`"order"`, sqlmock.NewRows(orderBatchColumns).AddRow(11, "uid-1", "WBILMTESTTRACK", dated, "created")},
+		{"delivery", sqlmock.NewRows(deliveryBatchColumns).AddRow(21, "Ivan", 11)},
+		{"payment", sqlmock.NewRows(paymentBatchColumns).AddRow(31, "t-1", 11)},
+		{"item", sqlmock.NewRows(itemBatchColumns).AddRow(41, "r-1", 11)},
+	}
+
+	for _, insert := range inserts {
+		if insert.table == table {
+			mock.ExpectQuery(`(?s)^\s*INSERT INTO ` + regexp.QuoteMeta(table) + ` `).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectRollback()
+
+			return
+		}
+
+		mock.ExpectQuery(`(?s)^\s*INSERT INTO ` + regexp.QuoteMeta(insert.table) + ` `).WillReturnRows(insert.rows)
+	}
+}
+
+func TestCreateOrderAggregate_RepeatedOrderReturnsExisting(t *testing.T) {
+	mock, repo, m := newTestOrderRepoWithMetrics(t)
+
+	// order_uid уже сохранен: ON CONFLICT DO NOTHING ничего не вставляет, и читается сохраненный агрегат
+	expectAggregateUntil(mock, `"order"`)
+	mock.ExpectQuery(`(?s)^SELECT .*WHERE o\.order_uid = \$1`).WithArgs("uid-1").
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "order_order_uid", "payment_id", "delivery_id", "item_id", "item_rid", "item_order_id"}).
+			AddRow(7, "uid-1", 8, 9, 10, "r-1", 7))
+
+	order, err := repo.CreateOrderAggregate(context.Background(), newBatchOrder("uid-1", "t-1", "r-1"))
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, 7, order.ID)
+	require.Equal(t, 8, order.Payment.ID)
+	require.Len(t, order.Items, 1)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.DuplicatesDetected.WithLabelValues("order")))
+}
+
+func TestCreateOrderAggregate_TakenChildKeyConflicts(t *testing.T) {
+	for _, table := range []string{"payment", "item"} {
+		t.Run(table, func(t *testing.T) {
+			mock, repo, m := newTestOrderRepoWithMetrics(t)
+
+			// transaction занят другим заказом или rid повторяется в заказе, а заказа с этим order_uid нет
+			expectAggregateUntil(mock, table)
+			mock.ExpectQuery(`(?s)^SELECT .*WHERE o\.order_uid = \$1`).WithArgs("uid-1").
+				WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+
+			_, err := repo.CreateOrderAggregate(context.Background(), newBatchOrder("uid-1", "t-1", "r-1"))
+			require.ErrorIs(t, err, ErrConflict)
+			require.NoError(t, mock.ExpectationsWereMet())
+
+			require.Zero(t, testutil.ToFloat64(m.DuplicatesDetected.WithLabelValues("order")))
+		})
+	}
+}
+
+func TestGetStatusHistory_ReadsStatusAndHistoryInOneTx(t *testing.T) {
+	mock, repo := newTestOrderRepo(t)
+
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status FROM "order" WHERE id = \$1 FOR SHARE;`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("paid"))
+	mock.ExpectQuery(`(?s)FROM order_status_history\s+WHERE order_id = \$1\s+ORDER BY id;`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "from_status", "to_status", "actor", "reason", "created_at"}).
+			AddRow(1, 7, "created", "paid", "support", "", created))
+	mock.ExpectCommit()
+
+	status, history, err := repo.GetStatusHistory(context.Background(), 7)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, models.StatusPaid, status)
+	require.Len(t, history, 1)
+	require.Equal(t, models.StatusPaid, history[0].To)
+}
+
+func TestGetStatusHistory_MissingOrder(t *testing.T) {
+	mock, repo := newTestOrderRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status FROM "order" WHERE id = \$1 FOR SHARE;`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	_, _, err := repo.GetStatusHistory(context.Background(), 7)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
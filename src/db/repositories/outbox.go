@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"orders/src/broker"
+	"orders/src/db"
+	"orders/src/db/models"
+	"orders/src/metrics"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type OutboxRepository interface {
+	// ClaimBatch возвращает nil без ошибки, пока аренду публикации держит другой инстанс
+	ClaimBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64) error
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepo struct {
+	pool    *sqlx.DB
+	guard   *db.Guard
+	metrics *metrics.Metrics
+}
+
+func NewOutboxRepo(pool *sqlx.DB, guard *db.Guard, metrics *metrics.Metrics) OutboxRepository {
+	return &outboxRepo{pool: pool, guard: guard, metrics: metrics}
+}
+
+// newOrderEvent сохраняет контекст трассировки, чтобы публикация продолжила трейс записи заказа
+func newOrderEvent(ctx context.Context, eventType string, orderID int, orderUID string, data any) (models.OutboxEvent, error) {
+	payload, err := json.Marshal(broker.OrderEvent{
+		Type:       eventType,
+		OrderID:    orderID,
+		OrderUID:   orderUID,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	headers, err := json.Marshal(carrier)
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+
+	return models.OutboxEvent{
+		AggregateID: orderID,
+		EventType:   eventType,
+		Key:         orderUID,
+		Payload:     payload,
+		Headers:     headers,
+	}, nil
+}
+
+// insertEvent пишет событие в outbox; вызывается в транзакции, которая меняет заказ
+func insertEvent(ctx context.Context, q sqlx.ExtContext, event models.OutboxEvent) error {
+	query := `
+	INSERT INTO outbox (aggregate_id, event_type, event_key, payload, headers)
+	VALUES ($1, $2, $3, $4::jsonb, $5::jsonb);`
+
+	_, err := q.ExecContext(ctx, query, event.AggregateID, event.EventType, event.Key, string(event.Payload), string(event.Headers))
+
+	return err
+}
+
+func insertEvents(ctx context.Context, q sqlx.ExtContext, events []models.OutboxEvent) error {
+	n := len(events)
+	aggregateIDs, types, keys, payloads, headers := make([]int64, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+
+	for i, e := range events {
+		aggregateIDs[i], types[i], keys[i] = int64(e.AggregateID), e.EventType, e.Key
+		payloads[i], headers[i] = string(e.Payload), string(e.Headers)
+	}
+
+	query := `
+	INSERT INTO outbox (aggregate_id, event_type, event_key, payload, headers)
+	SELECT aggregate_id, event_type, event_key, payload::jsonb, headers::jsonb
+	FROM unnest($1::int[], $2::varchar[], $3::varchar[], $4::text[], $5::text[]) AS e (aggregate_id, event_type, event_key, payload, headers);`
+
+	_, err := q.ExecContext(ctx, query, aggregateIDs, types, keys, payloads, headers)
+
+	return err
+}
+
+func (repo *outboxRepo) ClaimBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		events, err = repo.claimBatch(ctx, owner, lease, limit)
+
+		return err
+	})
+
+	return events, err
+}
+
+func (repo *outboxRepo) claimBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	start := time.Now()
+
+	var events []models.OutboxEvent
+
+	err := db.WithTx(ctx, repo.pool, func(tx *sqlx.Tx) error {
+		// Публикует один инстанс, иначе события одного заказа могли бы уйти не по порядку
+		leaseQuery := `
+		INSERT INTO outbox_lease (id, owner, expires_at) VALUES (1, $1, now() + make_interval(secs => $2))
+		ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+		WHERE outbox_lease.owner = excluded.owner OR outbox_lease.expires_at < now()
+		RETURNING owner;`
+
+		var holder string
+
+		err := tx.GetContext(ctx, &holder, leaseQuery, owner, lease.Seconds())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// id выдается при вставке, а коммит бывает позже: события открытых транзакций ждут их коммита
+		query := `SELECT id, aggregate_id, event_type, event_key, payload, headers, created_at
+		FROM outbox
+		WHERE published_at IS NULL AND txid < txid_snapshot_xmin(txid_current_snapshot())
+		ORDER BY id
+		LIMIT $1;`
+
+		return tx.SelectContext(ctx, &events, query, limit)
+	})
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("outbox_claim_batch", "outbox").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("outbox_claim_batch", "outbox").Inc()
+
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (repo *outboxRepo) MarkPublished(ctx context.Context, ids []int64) error {
+	return repo.guard.Do(ctx, func(ctx context.Context) error {
+		return repo.markPublished(ctx, ids)
+	})
+}
+
+func (repo *outboxRepo) markPublished(ctx context.Context, ids []int64) error {
+	start := time.Now()
+
+	_, err := repo.pool.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = ANY($1);`, ids)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("outbox_mark_published", "outbox").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("outbox_mark_published", "outbox").Inc()
+	}
+
+	return err
+}
+
+func (repo *outboxRepo) Prune(ctx context.Context, before time.Time) (int64, error) {
+	var pruned int64
+	var err error
+
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		pruned, err = repo.prune(ctx, before)
+
+		return err
+	})
+
+	return pruned, err
+}
+
+func (repo *outboxRepo) prune(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+
+	res, err := repo.pool.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1;`, before)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("outbox_prune", "outbox").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("outbox_prune", "outbox").Inc()
+
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
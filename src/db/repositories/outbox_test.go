@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"orders/src/broker"
+	"orders/src/config"
+	"orders/src/db"
+	"orders/src/db/models"
+	"orders/src/logger"
+	"orders/src/metrics"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewOrderEvent_CarriesTraceContext(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "create-order")
+	defer span.End()
+
+	change := models.StatusChange{OrderID: 5, From: models.StatusCreated, To: models.StatusPaid}
+
+	event, err := newOrderEvent(ctx, broker.EventOrderStatusChanged, 5, "b563feb7b2b84b6test", change)
+	require.NoError(t, err)
+
+	require.Equal(t, 5, event.AggregateID)
+	require.Equal(t, "b563feb7b2b84b6test", event.Key)
+
+	var payload struct {
+		broker.OrderEvent
+		Data models.StatusChange `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(event.Payload, &payload))
+	require.Equal(t, broker.EventOrderStatusChanged, payload.Type)
+	require.Equal(t, "b563feb7b2b84b6test", payload.OrderUID)
+	require.Equal(t, models.StatusPaid, payload.Data.To)
+
+	// Из сохраненных заголовков восстанавливается тот же трейс
+	carrier := propagation.MapCarrier{}
+	require.NoError(t, json.Unmarshal(event.Headers, &carrier))
+
+	restored := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	require.Equal(t, span.SpanContext().TraceID(), restored.TraceID())
+}
+
+func newTestOutboxRepo(t *testing.T) (sqlmock.Sqlmock, OutboxRepository) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp), sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	m := &metrics.Metrics{
+		DBQueryDuration:     prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_db_query_duration_seconds"}, []string{"query", "service"}),
+		DBQueryErrors:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_db_query_errors_total"}, []string{"query", "service"}),
+		DBGuardRejections:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_db_guard_rejections_total"}, []string{"reason"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_circuit_breaker_state"}, []string{"name"}),
+	}
+
+	return mock, NewOutboxRepo(sqlx.NewDb(conn, "sqlmock"), db.NewGuard(config.Default().DB, m, logger.Discard()), m)
+}
+
+var outboxTestColumns = []string{"id", "aggregate_id", "event_type", "event_key", "payload", "headers", "created_at"}
+
+func TestClaimBatch_ReturnsCommittedEventsInOrder(t *testing.T) {
+	mock, repo := newTestOutboxRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`(?s)INSERT INTO outbox_lease .*RETURNING owner;`).WithArgs("relay-1", 30.0).
+		WillReturnRows(sqlmock.NewRows([]string{"owner"}).AddRow("relay-1"))
+	mock.ExpectQuery(`(?s)FROM outbox\s+WHERE published_at IS NULL AND txid < txid_snapshot_xmin\(txid_current_snapshot\(\)\)\s+ORDER BY id\s+LIMIT \$1;`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(outboxTestColumns).
+			AddRow(1, 11, "order.created", "uid-1", []byte(`{}`), []byte(`{}`), time.Now()).
+			AddRow(2, 11, "order.status_changed", "uid-1", []byte(`{}`), []byte(`{}`), time.Now()))
+	mock.ExpectCommit()
+
+	events, err := repo.ClaimBatch(context.Background(), "relay-1", 30*time.Second, 10)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, events, 2)
+	require.Equal(t, []int64{1, 2}, []int64{events[0].ID, events[1].ID})
+}
+
+func TestClaimBatch_SkipsWhenAnotherInstanceHoldsLease(t *testing.T) {
+	mock, repo := newTestOutboxRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`(?s)INSERT INTO outbox_lease .*RETURNING owner;`).WithArgs("relay-1", 30.0).
+		WillReturnRows(sqlmock.NewRows([]string{"owner"}))
+	mock.ExpectCommit()
+
+	events, err := repo.ClaimBatch(context.Background(), "relay-1", 30*time.Second, 10)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Empty(t, events)
+}
+
+func TestMarkPublished(t *testing.T) {
+	mock, repo := newTestOutboxRepo(t)
+
+	mock.ExpectExec(`UPDATE outbox SET published_at = now\(\) WHERE id = ANY\(\$1\)`).WithArgs([]int64{1, 2}).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	require.NoError(t, repo.MarkPublished(context.Background(), []int64{1, 2}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
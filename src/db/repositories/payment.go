@@ -2,15 +2,17 @@ package repositories
 
 import (
 	"context"
-	"log"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"orders/src/db"
 	"orders/src/db/models"
+	"orders/src/logger"
 	"orders/src/metrics"
-	"orders/src/myretry"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/sethvargo/go-retry"
 )
 
 type PaymentRepository interface {
@@ -21,48 +23,61 @@ type PaymentRepository interface {
 
 type paymentRepo struct {
 	pool    *sqlx.DB
-	b       func() retry.Backoff
+	guard   *db.Guard
 	metrics *metrics.Metrics
+	log     *slog.Logger
 }
 
-func NewPaymentRepo(pool *sqlx.DB, metrics *metrics.Metrics) PaymentRepository {
-	b := myretry.NewBackofFactory()
-	return &paymentRepo{pool: pool, b: b, metrics: metrics}
+func NewPaymentRepo(pool *sqlx.DB, guard *db.Guard, metrics *metrics.Metrics, log *slog.Logger) PaymentRepository {
+	return &paymentRepo{pool: pool, guard: guard, metrics: metrics, log: logger.Component(log, "payment-repo")}
 }
 
 func (repo *paymentRepo) CreatePayment(ctx context.Context, paymentDto *models.Payment) (models.Payment, error) {
 	var payment models.Payment
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
+		payment, err = repo.createPayment(ctx, repo.pool, paymentDto)
 
-		payment, err = repo.createPayment(ctx, paymentDto)
+		// Оплаты с такой transaction нет — значит, у заказа уже есть другая
+		if errors.Is(err, errDuplicate) {
+			payment, err = repo.getPaymentByTransaction(ctx, paymentDto.Transaction)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("payment %s: order %d already has a payment: %w", paymentDto.Transaction, paymentDto.OrderID, ErrConflict)
+			}
+
+			if err == nil {
+				repo.metrics.DuplicatesDetected.WithLabelValues("payment").Inc()
+			}
 		}
 
 		return err
 	})
 
-	return payment, err
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment, nil
 }
 
-func (repo *paymentRepo) createPayment(ctx context.Context, paymentDto *models.Payment) (models.Payment, error) {
+func (repo *paymentRepo) createPayment(ctx context.Context, q sqlx.ExtContext, paymentDto *models.Payment) (models.Payment, error) {
 	start := time.Now()
 
 	var payment models.Payment
 
 	query := `
      INSERT INTO payment (currency, delivery_cost, provider,
-amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total)
+amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total, order_id)
 VALUES (:currency, :delivery_cost, :provider,
-:amount, :payment_dt, :bank, :request_id, :transaction, :custom_fee, :goods_total)
+:amount, :payment_dt, :bank, :request_id, :transaction, :custom_fee, :goods_total, :order_id)
+ON CONFLICT DO NOTHING
 RETURNING id, currency, delivery_cost, provider,
-amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total;
+amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total, order_id;
     `
 
-	rows, err := repo.pool.NamedQueryContext(ctx, query, &paymentDto)
+	rows, err := sqlx.NamedQueryContext(ctx, q, query, paymentDto)
 
 	lat := time.Since(start).Seconds()
 	repo.metrics.DBQueryDuration.WithLabelValues("create_payment", "payment_service").Observe(lat)
@@ -75,11 +90,88 @@ amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total;
 
 	defer rows.Close()
 
-	for rows.Next() {
-		if err = rows.StructScan(&payment); err != nil {
-			log.Printf("Error while parsing rows %v", err)
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
 			return models.Payment{}, err
 		}
+
+		return models.Payment{}, errDuplicate
+	}
+
+	if err = rows.StructScan(&payment); err != nil {
+		repo.log.ErrorContext(ctx, "scan row", "query", "create_payment", "error", err)
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+func (repo *paymentRepo) createPayments(ctx context.Context, q sqlx.ExtContext, paymentDtos []models.Payment) ([]models.Payment, error) {
+	start := time.Now()
+
+	n := len(paymentDtos)
+	currencies, providers, banks := make([]string, n), make([]string, n), make([]string, n)
+	requestIDs, transactions := make([]string, n), make([]string, n)
+	deliveryCosts, amounts, paymentDts := make([]int64, n), make([]int64, n), make([]int64, n)
+	customFees, goodsTotals, orderIDs := make([]int64, n), make([]int64, n), make([]int64, n)
+
+	for i, p := range paymentDtos {
+		currencies[i], providers[i], banks[i] = p.Currency, p.Provider, p.Bank
+		requestIDs[i], transactions[i] = p.RequestID, p.Transaction
+		deliveryCosts[i], amounts[i], paymentDts[i] = int64(p.DeliveryCost), int64(p.Amount), int64(p.PaymentDt)
+		customFees[i], goodsTotals[i], orderIDs[i] = int64(p.CustomFee), int64(p.GoodsTotal), int64(p.OrderID)
+	}
+
+	query := `
+     INSERT INTO payment (currency, delivery_cost, provider,
+amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total, order_id)
+SELECT * FROM unnest($1::varchar[], $2::int[], $3::varchar[],
+$4::int[], $5::int[], $6::varchar[], $7::varchar[], $8::varchar[], $9::int[], $10::int[], $11::int[])
+ON CONFLICT DO NOTHING
+RETURNING id, currency, delivery_cost, provider,
+amount, payment_dt, bank, request_id, transaction, custom_fee, goods_total, order_id;
+    `
+
+	var payments []models.Payment
+
+	err := sqlx.SelectContext(ctx, q, &payments, query, currencies, deliveryCosts, providers,
+		amounts, paymentDts, banks, requestIDs, transactions, customFees, goodsTotals, orderIDs)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("create_payments", "payment_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("create_payments", "payment_service").Inc()
+
+		return nil, err
+	}
+
+	if len(payments) < n {
+		return nil, errDuplicate
+	}
+
+	return payments, nil
+}
+
+func (repo *paymentRepo) getPaymentByTransaction(ctx context.Context, transaction string) (models.Payment, error) {
+	start := time.Now()
+
+	var payment models.Payment
+
+	query := `select id, transaction, request_id, currency, provider, amount, payment_dt, bank,
+			delivery_cost, goods_total, custom_fee, order_id
+			from payment
+			where transaction = $1;`
+
+	err := repo.pool.GetContext(ctx, &payment, query, transaction)
+
+	lat := time.Since(start).Seconds()
+	repo.metrics.DBQueryDuration.WithLabelValues("get_payment_by_transaction", "payment_service").Observe(lat)
+
+	if err != nil {
+		repo.metrics.DBQueryErrors.WithLabelValues("get_payment_by_transaction", "payment_service").Inc()
+
+		return models.Payment{}, err
 	}
 
 	return payment, nil
@@ -89,14 +181,9 @@ func (repo *paymentRepo) GetPaymentByID(ctx context.Context, paymentID int) (mod
 	var payment models.Payment
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		payment, err = repo.getPaymentByID(ctx, paymentID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
 	})
 
@@ -120,7 +207,7 @@ func (repo *paymentRepo) getPaymentByID(ctx context.Context, paymentID int) (mod
 	if err != nil {
 		repo.metrics.DBQueryErrors.WithLabelValues("get_payment_by_id", "payment_service").Inc()
 
-		log.Printf("Error in GetPaymentByID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_payment_by_id", err)
 		return models.Payment{}, err
 	}
 
@@ -131,14 +218,9 @@ func (repo *paymentRepo) GetPaymentByOrderID(ctx context.Context, orderID int) (
 	var payment models.Payment
 	var err error
 
-	err = retry.Do(ctx, repo.b(), func(ctx context.Context) error {
-
+	err = repo.guard.Do(ctx, func(ctx context.Context) error {
 		payment, err = repo.getPaymentByOrderID(ctx, orderID)
 
-		if db.IsRetryable(err) {
-			return retry.RetryableError(err)
-		}
-
 		return err
 	})
 
@@ -162,7 +244,7 @@ func (repo *paymentRepo) getPaymentByOrderID(ctx context.Context, orderID int) (
 	if err != nil {
 		repo.metrics.DBQueryErrors.WithLabelValues("get_payment_by_order_id", "payment_service").Inc()
 
-		log.Printf("Error in GetPaymentByID: %v\n", err)
+		logQueryError(ctx, repo.log, "get_payment_by_order_id", err)
 		return models.Payment{}, err
 	}
 
@@ -1,27 +1,94 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"io"
+	"net"
 	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE, которые разбирает сервис (https://www.postgresql.org/docs/current/errcodes-appendix.html)
+const (
+	codeUniqueViolation      = "23505"
+	codeCheckViolation       = "23514"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeLockNotAvailable     = "55P03"
+	codeTooManyConnections   = "53300"
+	codeAdminShutdown        = "57P01"
+	codeCrashShutdown        = "57P02"
+	codeCannotConnectNow     = "57P03"
+
+	// classConnectionException — класс 08: соединение потеряно или не установлено
+	classConnectionException = "08"
 )
 
+var retryableCodes = map[string]bool{
+	codeSerializationFailure: true,
+	codeDeadlockDetected:     true,
+	codeLockNotAvailable:     true,
+	codeTooManyConnections:   true,
+	codeAdminShutdown:        true,
+	codeCrashShutdown:        true,
+	codeCannotConnectNow:     true,
+}
+
+// IsRetryable решает, исправит ли ошибку повтор запроса: конфликт транзакций, перегрузка или перезапуск сервера
+// и сетевые ошибки. Нарушения ограничений, ошибки в данных и отмена или таймаут запроса клиентом не повторяются
 func IsRetryable(err error) bool {
-	if err == nil {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return false
 	}
 
-	if errors.Is(err, sql.ErrConnDone) || errors.Is(err, sql.ErrTxDone) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return retryableCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, classConnectionException)
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
 		return true
 	}
 
-	msg := strings.ToLower(err.Error())
-	retryableErrors := []string{"deadlock", "timeout", "connection refused", "temporarily unavailable", "too many connections", "failed to connect"}
+	// Запрос не успел уйти на сервер — повтор безопасен даже для записи
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsUniqueViolation — запись нарушает уникальный ключ; повтор не поможет
+func IsUniqueViolation(err error) bool {
+	return hasCode(err, codeUniqueViolation)
+}
 
-	for _, retryableErr := range retryableErrors {
-		if strings.Contains(msg, retryableErr) {
-			return true
-		}
+// IsCheckViolation — данные не прошли CHECK-ограничение; повтор не поможет
+func IsCheckViolation(err error) bool {
+	return hasCode(err, codeCheckViolation)
+}
+
+// ConstraintName возвращает имя нарушенного ограничения или пустую строку
+func ConstraintName(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
 	}
-	return false
+
+	return ""
+}
+
+func hasCode(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("update: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"bad conn", driver.ErrBadConn, true},
+
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"check violation", &pgconn.PgError{Code: "23514"}, false},
+		{"syntax error", &pgconn.PgError{Code: "42601"}, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), false},
+		// Текст больше не учитывается: «timeout» в сообщении не делает ошибку временной
+		{"plain text", errors.New("statement timeout in user data"), false},
+		{"nil", nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, IsRetryable(c.err))
+		})
+	}
+}
+
+func TestConstraintViolations(t *testing.T) {
+	unique := fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "order_order_uid_key"})
+	check := &pgconn.PgError{Code: "23514", ConstraintName: "item_sale_check"}
+
+	require.True(t, IsUniqueViolation(unique))
+	require.False(t, IsCheckViolation(unique))
+	require.Equal(t, "order_order_uid_key", ConstraintName(unique))
+
+	require.True(t, IsCheckViolation(check))
+	require.False(t, IsUniqueViolation(check))
+
+	require.Empty(t, ConstraintName(errors.New("boom")))
+}
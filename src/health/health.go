@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check проверяет одну зависимость; nil — зависимость доступна
+type Check func(ctx context.Context) error
+
+// Статусы в ответе /readyz
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusDegraded     = "degraded"
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckResult — результат проверки одной зависимости
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report — сводный результат: Status = ok, если прошли все проверки, degraded — если не прошли только
+// необязательные, fail — если не прошла обязательная. При остановке — shutting_down
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// Checker собирает проверки зависимостей для /readyz. Проверки выполняются параллельно,
+// каждая с таймаутом timeout
+type Checker struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add регистрирует проверку. Вызывается при старте, до запуска HTTP-сервера
+func (h *Checker) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// AddOptional регистрирует проверку зависимости, без которой сервис работает в урезанном режиме:
+// ее отказ переводит отчет в degraded, но не снимает готовность
+func (h *Checker) AddOptional(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check, optional: true})
+}
+
+// ShutDown переводит сервис в not ready: балансировщик перестает слать трафик до остановки HTTP-сервера
+func (h *Checker) ShutDown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Checker) Check(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range h.checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(checkCtx)
+
+			result := CheckResult{Status: StatusOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+
+			if err != nil {
+				result.Status, result.Error = StatusFail, err.Error()
+
+				if c.optional {
+					result.Status = StatusDegraded
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[c.name] = result
+
+			switch {
+			case err == nil:
+			case !c.optional:
+				report.Status = StatusFail
+			case report.Status == StatusOK:
+				report.Status = StatusDegraded
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if h.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+
+	return report
+}
+
+var errPending = errors.New("in progress")
+
+// Flag — проверка разового шага старта (например, прогрева кеша): не проходит, пока не вызван Done
+type Flag struct {
+	done atomic.Bool
+}
+
+func (f *Flag) Done() {
+	f.done.Store(true)
+}
+
+func (f *Flag) Check(context.Context) error {
+	if !f.done.Load() {
+		return errPending
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Report(t *testing.T) {
+	checker := NewChecker(time.Second)
+
+	checker.Add("db", func(context.Context) error { return nil })
+	checker.Add("redis", func(context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Check(context.Background())
+
+	require.False(t, report.Ready())
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, StatusOK, report.Checks["db"].Status)
+	require.Equal(t, StatusFail, report.Checks["redis"].Status)
+	require.Equal(t, "connection refused", report.Checks["redis"].Error)
+}
+
+func TestChecker_OptionalDegrades(t *testing.T) {
+	checker := NewChecker(time.Second)
+
+	checker.Add("db", func(context.Context) error { return nil })
+	checker.AddOptional("redis", func(context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Check(context.Background())
+
+	require.True(t, report.Ready())
+	require.Equal(t, StatusDegraded, report.Status)
+	require.Equal(t, StatusDegraded, report.Checks["redis"].Status)
+
+	// Отказ обязательной проверки важнее
+	checker.Add("kafka", func(context.Context) error { return errors.New("no brokers") })
+
+	require.Equal(t, StatusFail, checker.Check(context.Background()).Status)
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+
+	checker.Add("kafka", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Check(context.Background())
+
+	require.False(t, report.Ready())
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks["kafka"].Error)
+}
+
+func TestChecker_WarmUpAndShutdown(t *testing.T) {
+	checker := NewChecker(time.Second)
+
+	var warmUp Flag
+	checker.Add("cache_warmup", warmUp.Check)
+
+	require.False(t, checker.Check(context.Background()).Ready())
+
+	warmUp.Done()
+	require.True(t, checker.Check(context.Background()).Ready())
+
+	checker.ShutDown()
+
+	report := checker.Check(context.Background())
+	require.False(t, report.Ready())
+	require.Equal(t, StatusShuttingDown, report.Status)
+}
@@ -0,0 +1,47 @@
+package adminroute
+
+import (
+	"log/slog"
+	"net/http"
+	"orders/src/http-server/auth"
+	"orders/src/logger"
+	"orders/src/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logLevel — тело GET и PUT /admin/log/level
+type logLevel struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// AddAdminRoutes регистрирует служебные маршруты за authorize: GET /admin/log/level отдает текущий уровень логов,
+// PUT меняет его до перезапуска сервиса
+func AddAdminRoutes(router *gin.Engine, level *slog.LevelVar, log *slog.Logger, authorize gin.HandlerFunc) {
+	admin := router.Group("/admin", authorize)
+
+	admin.GET("/log/level", func(c *gin.Context) {
+		c.JSON(http.StatusOK, logLevel{Level: logger.LevelName(level)})
+	})
+
+	admin.PUT("/log/level", func(c *gin.Context) {
+		var req logLevel
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "body must be {\"level\": \"debug|info|warn|error\"}"))
+			return
+		}
+
+		prev := logger.LevelName(level)
+
+		if err := logger.SetLevel(level, req.Level); err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "%v", err))
+			return
+		}
+
+		log.WarnContext(c.Request.Context(), "log level changed", "from", prev, "to", logger.LevelName(level), "actor", auth.Principal(c))
+
+		c.JSON(http.StatusOK, logLevel{Level: logger.LevelName(level)})
+	})
+
+}
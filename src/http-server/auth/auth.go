@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"orders/src/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "auth.principal"
+
+// Middleware пропускает запросы с заголовком Authorization: Bearer <token>, где token есть в principals
+// (token -> имя клиента), и кладет имя клиента в контекст запроса. Остальным отвечает 401
+func Middleware(principals map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+		name := ""
+
+		// Сравниваются все токены за постоянное время, чтобы по времени ответа нельзя было подобрать токен
+		for candidate, principal := range principals {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+				name = principal
+			}
+		}
+
+		if !ok || token == "" || name == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			_ = c.Error(service.NewError(service.ErrUnauthorized, "valid bearer token is required"))
+			c.Abort()
+
+			return
+		}
+
+		c.Set(principalKey, name)
+		c.Next()
+	}
+}
+
+// Principal возвращает имя клиента, которого пропустил Middleware
+func Principal(c *gin.Context) string {
+	return c.GetString(principalKey)
+}
@@ -0,0 +1,58 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	httpserver "orders/src/http-server"
+	"orders/src/http-server/auth"
+	"orders/src/logger"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(httpserver.GinErrorMiddleware(logger.Discard()))
+	router.GET("/private", auth.Middleware(map[string]string{"s3cret": "support"}), func(c *gin.Context) {
+		c.String(http.StatusOK, auth.Principal(c))
+	})
+
+	cases := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"valid token", "Bearer s3cret", http.StatusOK, "support"},
+		{"no header", "", http.StatusUnauthorized, ""},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized, ""},
+		{"empty token", "Bearer ", http.StatusUnauthorized, ""},
+		{"not bearer", "Basic s3cret", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/private", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantStatus, w.Code)
+
+			if tc.wantStatus == http.StatusOK {
+				require.Equal(t, tc.wantBody, w.Body.String())
+				return
+			}
+
+			require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+			require.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+		})
+	}
+}
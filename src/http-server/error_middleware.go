@@ -0,0 +1,83 @@
+package httpserver
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"orders/src/service"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorResponse — тело ответа с ошибкой для всех маршрутов
+type errorResponse struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message"`
+	TraceID string               `json:"trace_id,omitempty"`
+	Fields  []service.FieldError `json:"fields,omitempty"`
+}
+
+// errorStatuses — HTTP-статус и код ответа для каждого класса ошибок сервиса
+var errorStatuses = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{service.ErrNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrValidation, http.StatusUnprocessableEntity, "validation_failed"},
+	{service.ErrConflict, http.StatusConflict, "conflict"},
+	{service.ErrUnavailable, http.StatusServiceUnavailable, "unavailable"},
+	{service.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+}
+
+// GinErrorMiddleware отдает последнюю ошибку, добавленную обработчиком через c.Error.
+// Неизвестные ошибки отдаются как 500 без подробностей, причина остается в логах и трейсе
+func GinErrorMiddleware(log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+
+		resp := errorResponse{
+			Code:    "internal",
+			Message: "internal error",
+			TraceID: traceID(c),
+		}
+		status := http.StatusInternalServerError
+
+		for _, s := range errorStatuses {
+			if errors.Is(err, s.kind) {
+				status, resp.Code = s.status, s.code
+				break
+			}
+		}
+
+		var domainErr *service.Error
+		if status != http.StatusInternalServerError && errors.As(err, &domainErr) {
+			resp.Message = domainErr.Message
+			resp.Fields = domainErr.Fields
+		}
+
+		if status >= http.StatusInternalServerError {
+			log.ErrorContext(c.Request.Context(), "request failed",
+				"method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+		}
+
+		c.JSON(status, resp)
+	}
+}
+
+func traceID(c *gin.Context) string {
+	spanCtx := trace.SpanContextFromContext(c.Request.Context())
+
+	if !spanCtx.HasTraceID() {
+		return ""
+	}
+
+	return spanCtx.TraceID().String()
+}
@@ -0,0 +1,30 @@
+package healthroute
+
+import (
+	"net/http"
+	"orders/src/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddHealthRoutes регистрирует /healthz (процесс жив) и /readyz (зависимости доступны, сервис принимает трафик)
+func AddHealthRoutes(router *gin.Engine, checker *health.Checker) {
+
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": health.StatusOK,
+		})
+	})
+
+	router.GET("/readyz", func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		c.JSON(status, report)
+	})
+
+}
@@ -2,41 +2,71 @@ package httpserver
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"orders/src/config"
+	"orders/src/health"
+	adminroute "orders/src/http-server/admin-route"
+	"orders/src/http-server/auth"
+	healthroute "orders/src/http-server/health-route"
 	orderroute "orders/src/http-server/order-route"
+	"orders/src/logger"
 	"orders/src/metrics"
 	"orders/src/service"
-	"os"
-	"time"
+	"strconv"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func NewServer(ctx context.Context, met *metrics.Metrics, orderService service.OrderService) *http.Server {
-	httpPort := ":" + os.Getenv("HTTP_PORT")
+// NewServer запускает HTTP-сервер. level — уровень логов сервиса, его меняет /admin/log/level
+func NewServer(ctx context.Context, cfg config.HTTP, met *metrics.Metrics, checker *health.Checker, orderService service.OrderService,
+	log *slog.Logger, level *slog.LevelVar) *http.Server {
+	httpPort := ":" + strconv.Itoa(cfg.Port)
 
-	router := gin.Default()
+	log = logger.Component(log, "http")
+
+	router := gin.New()
+	router.Use(gin.Recovery())
 	router.Use(otelgin.Middleware("http-service"))
-	router.Use(cors.Default()) // All origins allowed by default
+	router.Use(GinLogMiddleware(log))
+	// Открытые маршруты доступны любому источнику. Заголовок Authorization cors.Default не разрешает,
+	// поэтому маршруты за auth.Middleware из браузера с чужого сайта не вызвать
+	router.Use(cors.Default())
 
 	router.Use(GinMetricsMiddleware(met))
+	router.Use(GinErrorMiddleware(log))
 
 	router.GET("/metrics", gin.WrapH(met.Handler()))
 
-	orderroute.AddOrderRoutes(ctx, router, orderService)
+	healthroute.AddHealthRoutes(router, checker)
+
+	if len(cfg.Tokens) == 0 {
+		log.WarnContext(ctx, "no http tokens configured, status changes and admin routes are rejected")
+	}
+
+	authorize := auth.Middleware(cfg.Principals())
+
+	adminroute.AddAdminRoutes(router, level, log, authorize)
+
+	orderroute.AddOrderRoutes(router, orderService, authorize)
+
+	addWebRoutes(router)
 
 	srv := &http.Server{
 		Addr:              httpPort,
 		Handler:           router.Handler(),
-		ReadHeaderTimeout: 5 * time.Second,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			log.Printf("http: %v", err)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.ErrorContext(ctx, "http server stopped", "error", err)
 		}
 
 	}()
@@ -0,0 +1,43 @@
+package httpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinLogMiddleware пишет строку о каждом запросе вместо текстового логгера gin. Подключается после otelgin,
+// чтобы в записи попали trace_id и span_id. Служебные /metrics, /healthz и /readyz пишутся на уровне debug
+func GinLogMiddleware(log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+
+		level := slog.LevelInfo
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case isProbe(c.FullPath()):
+			level = slog.LevelDebug
+		}
+
+		log.Log(c.Request.Context(), level, "http request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+func isProbe(route string) bool {
+	return route == "/metrics" || route == "/healthz" || route == "/readyz"
+}
@@ -1,37 +1,151 @@
 package orderroute
 
 import (
-	"context"
-	"fmt"
+	"orders/src/db/repositories"
+	"orders/src/http-server/auth"
 	"orders/src/service"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AddOrderRoutes(ctx context.Context, router *gin.Engine, orderService service.OrderService) {
+// listOrdersQuery — параметры GET /orders; даты в RFC 3339
+type listOrdersQuery struct {
+	CustomerID      string    `form:"customer_id"`
+	TrackNumber     string    `form:"track_number"`
+	DeliveryService string    `form:"delivery_service"`
+	Locale          string    `form:"locale"`
+	DateFrom        time.Time `form:"date_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	DateTo          time.Time `form:"date_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Currency        string    `form:"currency"`
+	Provider        string    `form:"provider"`
+	NmID            int       `form:"nm_id"`
+	Brand           string    `form:"brand"`
+	Limit           int       `form:"limit"`
+	Cursor          string    `form:"cursor"`
+}
+
+// AddOrderRoutes регистрирует маршруты заказов. Ошибки передаются через c.Error и отдаются GinErrorMiddleware.
+// authorize стоит перед изменяющими маршрутами, автор изменения — клиент, которого он пропустил
+func AddOrderRoutes(router *gin.Engine, orderService service.OrderService, authorize gin.HandlerFunc) {
 
 	router.GET("/order/:orderID", func(c *gin.Context) {
 		orderID, err := strconv.Atoi(c.Param("orderID"))
 
 		if err != nil {
-			c.AbortWithStatusJSON(400, gin.H{
-				"message": "orderID must be an integer string",
-			})
+			_ = c.Error(service.NewError(service.ErrValidation, "orderID must be an integer string"))
+			return
+		}
+
+		order, err := orderService.GetOrderByID(c.Request.Context(), orderID)
+
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"order": order,
+		})
+	})
+
+	router.GET("/order/:orderID/status", func(c *gin.Context) {
+		orderID, err := strconv.Atoi(c.Param("orderID"))
+
+		if err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "orderID must be an integer string"))
+			return
+		}
+
+		history, err := orderService.GetStatusHistory(c.Request.Context(), orderID)
+
+		if err != nil {
+			_ = c.Error(err)
 			return
 		}
-		order, err := orderService.GetOrderByID(ctx, orderID)
+
+		c.JSON(200, history)
+	})
+
+	router.POST("/order/:orderID/status", authorize, func(c *gin.Context) {
+		orderID, err := strconv.Atoi(c.Param("orderID"))
 
 		if err != nil {
-			c.AbortWithStatusJSON(400, gin.H{
-				"message": fmt.Sprintf("Error: %v\n", err),
-			})
+			_ = c.Error(service.NewError(service.ErrValidation, "orderID must be an integer string"))
 			return
+		}
 
+		var req service.StatusChangeRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "invalid body: %v", err))
+			return
 		}
+
+		req.Actor = auth.Principal(c)
+
+		change, err := orderService.ChangeStatus(c.Request.Context(), orderID, req)
+
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"change": change,
+		})
+	})
+
+	router.GET("/order/uid/:orderUID", func(c *gin.Context) {
+		order, err := orderService.GetOrderByUID(c.Request.Context(), c.Param("orderUID"))
+
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+
 		c.JSON(200, gin.H{
 			"order": order,
 		})
 	})
 
+	router.GET("/orders", func(c *gin.Context) {
+		var query listOrdersQuery
+
+		if err := c.ShouldBindQuery(&query); err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "invalid query: %v", err))
+			return
+		}
+
+		cursor, err := repositories.DecodeOrderCursor(query.Cursor)
+
+		if err != nil {
+			_ = c.Error(service.NewError(service.ErrValidation, "invalid cursor"))
+			return
+		}
+
+		page, err := orderService.ListOrders(c.Request.Context(), repositories.OrderFilter{
+			CustomerID:      query.CustomerID,
+			TrackNumber:     query.TrackNumber,
+			DeliveryService: query.DeliveryService,
+			Locale:          query.Locale,
+			DateFrom:        query.DateFrom,
+			DateTo:          query.DateTo,
+			Currency:        query.Currency,
+			Provider:        query.Provider,
+			NmID:            query.NmID,
+			Brand:           query.Brand,
+			After:           cursor,
+			Limit:           query.Limit,
+		})
+
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+
+		c.JSON(200, page)
+	})
+
 }
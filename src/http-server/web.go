@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Страница поиска заказа работает только через JSON API (/order/:orderID, /order/uid/:orderUID)
+//
+//go:embed web
+var webFiles embed.FS
+
+func addWebRoutes(router *gin.Engine) {
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+
+	router.GET("/", func(c *gin.Context) {
+		c.FileFromFS("/", http.FS(static))
+	})
+
+	router.StaticFS("/static", http.FS(static))
+}
@@ -0,0 +1,169 @@
+"use strict";
+
+const form = document.getElementById("lookup");
+const input = document.getElementById("query");
+const statusBox = document.getElementById("status");
+const result = document.getElementById("result");
+
+class NotFoundError extends Error {}
+
+const orderFields = [
+  ["id", "id"],
+  ["order_uid", "order_uid"],
+  ["status", "Статус"],
+  ["track_number", "Трек-номер"],
+  ["entry", "entry"],
+  ["customer_id", "Покупатель"],
+  ["locale", "Локаль"],
+  ["delivery_service", "Служба доставки"],
+  ["shardkey", "shardkey"],
+  ["sm_id", "sm_id"],
+  ["oof_shard", "oof_shard"],
+  ["date_created", "Создан", formatDate],
+];
+
+const deliveryFields = [
+  ["name", "Получатель"],
+  ["phone", "Телефон"],
+  ["email", "Email"],
+  ["zip", "Индекс"],
+  ["region", "Регион"],
+  ["city", "Город"],
+  ["address", "Адрес"],
+];
+
+const paymentFields = [
+  ["transaction", "Транзакция"],
+  ["request_id", "request_id"],
+  ["provider", "Провайдер"],
+  ["bank", "Банк"],
+  ["currency", "Валюта"],
+  ["goods_total", "Товары"],
+  ["delivery_cost", "Доставка"],
+  ["custom_fee", "Пошлина"],
+  ["amount", "Итого"],
+  ["payment_dt", "Оплачен", (v) => formatDate(v * 1000)],
+];
+
+const itemColumns = ["chrt_id", "nm_id", "name", "brand", "size", "price", "sale", "total_price", "status", "rid"];
+
+function formatDate(value) {
+  const date = new Date(value);
+  return Number.isNaN(date.getTime()) ? String(value) : date.toLocaleString();
+}
+
+// Число ищется по id, а если такого заказа нет — по order_uid, который тоже может состоять из цифр
+async function findOrder(query) {
+  if (/^\d+$/.test(query)) {
+    try {
+      return await fetchOrder(`/order/${query}`);
+    } catch (err) {
+      if (!(err instanceof NotFoundError)) {
+        throw err;
+      }
+    }
+  }
+
+  return fetchOrder(`/order/uid/${encodeURIComponent(query)}`);
+}
+
+async function fetchOrder(path) {
+  const response = await fetch(path, { headers: { Accept: "application/json" } });
+  const body = await response.json().catch(() => ({}));
+
+  if (response.ok) {
+    return body.order;
+  }
+
+  const message = body.message || `HTTP ${response.status}`;
+
+  if (response.status === 404) {
+    throw new NotFoundError(message);
+  }
+
+  // trace_id помогает найти запрос в бэкенде трассировки
+  throw new Error(body.trace_id ? `${message} (trace_id ${body.trace_id})` : message);
+}
+
+function renderFields(target, fields, data) {
+  target.replaceChildren();
+
+  for (const [key, label, format] of fields) {
+    const value = data ? data[key] : undefined;
+    const dt = document.createElement("dt");
+    const dd = document.createElement("dd");
+
+    dt.textContent = label;
+    dd.textContent = value === undefined || value === null || value === "" ? "—" : format ? format(value) : value;
+
+    target.append(dt, dd);
+  }
+}
+
+function renderItems(items) {
+  const body = document.getElementById("items");
+  body.replaceChildren();
+
+  for (const item of items || []) {
+    const row = document.createElement("tr");
+
+    for (const column of itemColumns) {
+      const cell = document.createElement("td");
+      cell.textContent = item[column] ?? "—";
+      row.append(cell);
+    }
+
+    body.append(row);
+  }
+}
+
+function renderOrder(order) {
+  document.getElementById("order-title").textContent = order.order_uid;
+
+  renderFields(document.getElementById("order"), orderFields, order);
+  renderFields(document.getElementById("delivery"), deliveryFields, order.delivery);
+  renderFields(document.getElementById("payment"), paymentFields, order.payment);
+  renderItems(order.items);
+
+  result.hidden = false;
+}
+
+function showStatus(text, kind) {
+  statusBox.textContent = text;
+  statusBox.className = `status ${kind || ""}`;
+  statusBox.hidden = false;
+}
+
+form.addEventListener("submit", async (event) => {
+  event.preventDefault();
+
+  const query = input.value.trim();
+  if (!query) {
+    return;
+  }
+
+  const button = form.querySelector("button");
+  button.disabled = true;
+  result.hidden = true;
+  showStatus("Ищем заказ…");
+
+  try {
+    renderOrder(await findOrder(query));
+    statusBox.hidden = true;
+    history.replaceState(null, "", `#${encodeURIComponent(query)}`);
+  } catch (err) {
+    if (err instanceof NotFoundError) {
+      showStatus(`Заказ «${query}» не найден. Проверьте id или order_uid.`, "not-found");
+    } else {
+      showStatus(`Не удалось загрузить заказ: ${err.message}`, "error");
+    }
+  } finally {
+    button.disabled = false;
+  }
+});
+
+// Ссылку вида /#<id или order_uid> можно передать коллеге
+if (location.hash.length > 1) {
+  input.value = decodeURIComponent(location.hash.slice(1));
+  form.requestSubmit();
+}
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// NewLevel создает уровень из строки debug, info, warn или error
+func NewLevel(name string) (*slog.LevelVar, error) {
+	level := new(slog.LevelVar)
+
+	if err := SetLevel(level, name); err != nil {
+		return nil, err
+	}
+
+	return level, nil
+}
+
+// SetLevel меняет уровень; записи, которые уже пишутся, дописываются со старым
+func SetLevel(level *slog.LevelVar, name string) error {
+	var l slog.Level
+
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+
+	level.Set(l)
+
+	return nil
+}
+
+// LevelName — уровень в том же виде, в котором его принимает SetLevel
+func LevelName(level *slog.LevelVar) string {
+	return strings.ToLower(level.Level().String())
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Ключи атрибутов, общие для всех компонентов: по ним логи фильтруются и связываются с трейсами
+const (
+	KeyComponent = "component"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+	KeyOrderUID  = "order_uid"
+	KeyTopic     = "topic"
+	KeyPartition = "partition"
+	KeyOffset    = "offset"
+)
+
+// New создает JSON-логгер. Уровень читается из level при каждой записи, поэтому его можно менять на лету.
+// К каждой записи добавляются trace_id и span_id текущего спана и атрибуты, положенные в контекст через WithAttrs
+func New(w io.Writer, level *slog.LevelVar) *slog.Logger {
+	return slog.New(&handler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// Component возвращает логгер с атрибутом component
+func Component(log *slog.Logger, name string) *slog.Logger {
+	return log.With(KeyComponent, name)
+}
+
+// Discard — логгер, который ничего не пишет, для тестов и необязательных зависимостей
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+type ctxKey struct{}
+
+// WithAttrs кладет атрибуты в контекст: они попадут во все записи, сделанные с этим контекстом ниже по стеку.
+// Так consumer один раз указывает topic, partition и offset, а сервис и репозиторий их не знают
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+
+	return context.WithValue(ctx, ctxKey{}, append(prev[:len(prev):len(prev)], attrs...))
+}
+
+// OrderUID — атрибут order_uid
+func OrderUID(uid string) slog.Attr {
+	return slog.String(KeyOrderUID, uid)
+}
+
+// handler дополняет записи атрибутами из контекста
+type handler struct {
+	slog.Handler
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		r.AddAttrs(
+			slog.String(KeyTraceID, spanCtx.TraceID().String()),
+			slog.String(KeySpanID, spanCtx.SpanID().String()),
+		)
+	}
+
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]any
+		require.NoError(t, dec.Decode(&line))
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestLogger_TraceAndContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+
+	level, err := NewLevel("info")
+	require.NoError(t, err)
+
+	log := Component(New(&buf, level), "order-consumer")
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a},
+		SpanID:     trace.SpanID{0x0b},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+	ctx = WithAttrs(ctx, slog.String(KeyTopic, "orders"), slog.Int(KeyPartition, 2), slog.Int64(KeyOffset, 42))
+	ctx = WithAttrs(ctx, OrderUID("b563feb7b2b84b6test"))
+
+	log.InfoContext(ctx, "order saved")
+	log.Info("no context")
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 2)
+
+	require.Equal(t, "INFO", lines[0]["level"])
+	require.Equal(t, "order saved", lines[0]["msg"])
+	require.Equal(t, "order-consumer", lines[0][KeyComponent])
+	require.Equal(t, spanCtx.TraceID().String(), lines[0][KeyTraceID])
+	require.Equal(t, spanCtx.SpanID().String(), lines[0][KeySpanID])
+	require.Equal(t, "orders", lines[0][KeyTopic])
+	require.EqualValues(t, 2, lines[0][KeyPartition])
+	require.EqualValues(t, 42, lines[0][KeyOffset])
+	require.Equal(t, "b563feb7b2b84b6test", lines[0][KeyOrderUID])
+
+	require.Equal(t, "order-consumer", lines[1][KeyComponent])
+	require.NotContains(t, lines[1], KeyTraceID)
+	require.NotContains(t, lines[1], KeyTopic)
+}
+
+func TestWithAttrs_DoesNotShareParent(t *testing.T) {
+	parent := WithAttrs(context.Background(), slog.String(KeyTopic, "orders"))
+
+	first := WithAttrs(parent, OrderUID("first"))
+	second := WithAttrs(parent, OrderUID("second"))
+
+	require.Equal(t, []slog.Attr{slog.String(KeyTopic, "orders"), OrderUID("first")}, first.Value(ctxKey{}))
+	require.Equal(t, []slog.Attr{slog.String(KeyTopic, "orders"), OrderUID("second")}, second.Value(ctxKey{}))
+}
+
+func TestLevel_ChangesAtRuntime(t *testing.T) {
+	var buf bytes.Buffer
+
+	level, err := NewLevel("warn")
+	require.NoError(t, err)
+
+	log := New(&buf, level)
+
+	log.Info("hidden")
+	require.Zero(t, buf.Len())
+
+	require.NoError(t, SetLevel(level, "DEBUG"))
+	require.Equal(t, "debug", LevelName(level))
+
+	log.Debug("shown")
+	require.Len(t, decodeLines(t, &buf), 1)
+
+	require.Error(t, SetLevel(level, "verbose"))
+	require.Equal(t, "debug", LevelName(level))
+
+	_, err = NewLevel("")
+	require.Error(t, err)
+}
@@ -21,14 +21,52 @@ type Metrics struct {
 	DBQueryDuration *prometheus.HistogramVec
 	DBQueryErrors   *prometheus.CounterVec
 
+	// DBGuardRejections — запросы к БД, отклоненные без выполнения: reason = open, bulkhead, retry_budget
+	DBGuardRejections *prometheus.CounterVec
+
+	// DuplicatesDetected — повторно доставленные записи, распознанные по естественному ключу
+	DuplicatesDetected *prometheus.CounterVec
+
 	// Kafka
 	KafkaMessagesConsumed *prometheus.CounterVec
 	KafkaMessagesDLQ      *prometheus.CounterVec
 	KafkaConsumerRetries  *prometheus.CounterVec
+	KafkaMessagesDead     *prometheus.CounterVec
+
+	// Kafka consumer: отставание и закоммиченный оффсет по партициям, задержка чтения из брокера (по ReaderStats),
+	// длительность обработки по виду сообщения, занятые воркеры и ребалансировки группы
+	KafkaConsumerLag     *prometheus.GaugeVec
+	KafkaCommittedOffset *prometheus.GaugeVec
+	KafkaFetchLatency    *prometheus.GaugeVec
+	KafkaHandlerDuration *prometheus.HistogramVec
+	KafkaWorkersInFlight *prometheus.GaugeVec
+	KafkaRebalances      *prometheus.CounterVec
+
+	// Kafka consumer в режиме пачек: размер сохраненных пачек, время их записи по исходу и пачки,
+	// разобранные по одному сообщению после ошибки
+	KafkaBatchSize          *prometheus.HistogramVec
+	KafkaBatchFlushDuration *prometheus.HistogramVec
+	KafkaBatchFallbacks     *prometheus.CounterVec
+
+	// Outbox: события, опубликованные реле, ошибки публикации и удаленные опубликованные строки
+	OutboxEventsPublished *prometheus.CounterVec
+	OutboxPublishErrors   prometheus.Counter
+	OutboxEventsPruned    prometheus.Counter
 
 	// Redis / Cache
 	CacheHits   prometheus.Counter
 	CacheMisses prometheus.Counter
+
+	// Инвалидация локальных кешей: ключи, отправленные другим инстансам и полученные от них
+	CacheInvalidationsSent     prometheus.Counter
+	CacheInvalidationsReceived prometheus.Counter
+
+	// CircuitBreakerState — состояние автоматов перед зависимостями: 0 closed, 1 half-open, 2 open
+	CircuitBreakerState *prometheus.GaugeVec
+
+	// Прогрев кеша при старте
+	CacheWarmupDuration prometheus.Gauge
+	CacheWarmupOrders   prometheus.Gauge
 }
 
 func New(reg prometheus.Registerer, gatherer prometheus.Gatherer) *Metrics {
@@ -71,6 +109,20 @@ func New(reg prometheus.Registerer, gatherer prometheus.Gatherer) *Metrics {
 			},
 			[]string{"query", "service"},
 		),
+		DBGuardRejections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "db_guard_rejections_total",
+				Help: "DB calls rejected by the circuit breaker, concurrency limit or retry budget",
+			},
+			[]string{"reason"},
+		),
+		DuplicatesDetected: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "duplicates_detected_total",
+				Help: "Re-delivered records detected by natural key",
+			},
+			[]string{"entity"},
+		),
 		KafkaMessagesConsumed: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "kafka_messages_consumed_total",
@@ -92,6 +144,94 @@ func New(reg prometheus.Registerer, gatherer prometheus.Gatherer) *Metrics {
 			},
 			[]string{"topic"},
 		),
+		KafkaMessagesDead: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_messages_dead_total",
+				Help: "Kafka messages parked in the terminal DLQ topic",
+			},
+			[]string{"topic"},
+		),
+		KafkaConsumerLag: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kafka_consumer_lag",
+				Help: "Messages in the partition not yet committed by the consumer group",
+			},
+			[]string{"topic", "partition"},
+		),
+		KafkaCommittedOffset: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kafka_consumer_committed_offset",
+				Help: "Last offset committed by the consumer group (next offset to read)",
+			},
+			[]string{"topic", "partition"},
+		),
+		KafkaFetchLatency: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kafka_consumer_fetch_latency_seconds",
+				Help: "Time spent reading message batches from the broker over the last stats interval",
+			},
+			[]string{"topic", "stat"},
+		),
+		KafkaHandlerDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "kafka_handler_duration_seconds",
+				Help:    "Kafka message handling duration in seconds",
+				Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			[]string{"key"},
+		),
+		KafkaWorkersInFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "kafka_consumer_inflight_workers",
+				Help: "Kafka messages being handled right now",
+			},
+			[]string{"topic"},
+		),
+		KafkaRebalances: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_consumer_rebalances_total",
+				Help: "Consumer group rebalances seen by the reader",
+			},
+			[]string{"topic"},
+		),
+		KafkaBatchSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "kafka_consumer_batch_size",
+				Help:    "Messages in one consumer batch flush",
+				Buckets: []float64{2, 5, 10, 25, 50, 100, 250, 500, 1000},
+			},
+			[]string{"topic"},
+		),
+		KafkaBatchFlushDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "kafka_consumer_batch_flush_duration_seconds",
+				Help:    "Consumer batch persistence duration in seconds",
+				Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			[]string{"topic", "result"},
+		),
+		KafkaBatchFallbacks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_consumer_batch_fallbacks_total",
+				Help: "Consumer batches that failed and were handled message by message",
+			},
+			[]string{"topic"},
+		),
+		OutboxEventsPublished: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "outbox_events_published_total",
+				Help: "Domain events published from the outbox",
+			},
+			[]string{"event_type"},
+		),
+		OutboxPublishErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "outbox_publish_errors_total",
+			Help: "Failed outbox publish batches",
+		}),
+		OutboxEventsPruned: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "outbox_events_pruned_total",
+			Help: "Published outbox rows deleted after retention",
+		}),
 		CacheHits: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "cache_hits_total",
 			Help: "Total cache hits",
@@ -100,6 +240,29 @@ func New(reg prometheus.Registerer, gatherer prometheus.Gatherer) *Metrics {
 			Name: "cache_misses_total",
 			Help: "Total cache misses",
 		}),
+		CacheInvalidationsSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_invalidations_sent_total",
+			Help: "Cache keys invalidated on other instances via pub/sub",
+		}),
+		CacheInvalidationsReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_invalidations_received_total",
+			Help: "Cache keys evicted from the local cache by invalidations from other instances",
+		}),
+		CircuitBreakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "circuit_breaker_state",
+				Help: "Circuit breaker state: 0 closed, 1 half-open, 2 open",
+			},
+			[]string{"name"},
+		),
+		CacheWarmupDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_warmup_duration_seconds",
+			Help: "Duration of the startup cache warm-up",
+		}),
+		CacheWarmupOrders: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cache_warmup_orders",
+			Help: "Number of orders loaded into the cache during warm-up",
+		}),
 	}
 
 	// регистрация
@@ -109,11 +272,31 @@ func New(reg prometheus.Registerer, gatherer prometheus.Gatherer) *Metrics {
 		m.HTTPInflight,
 		m.DBQueryDuration,
 		m.DBQueryErrors,
+		m.DBGuardRejections,
+		m.DuplicatesDetected,
 		m.KafkaMessagesConsumed,
 		m.KafkaMessagesDLQ,
 		m.KafkaConsumerRetries,
+		m.KafkaMessagesDead,
+		m.KafkaConsumerLag,
+		m.KafkaCommittedOffset,
+		m.KafkaFetchLatency,
+		m.KafkaHandlerDuration,
+		m.KafkaWorkersInFlight,
+		m.KafkaRebalances,
+		m.KafkaBatchSize,
+		m.KafkaBatchFlushDuration,
+		m.KafkaBatchFallbacks,
+		m.OutboxEventsPublished,
+		m.OutboxPublishErrors,
+		m.OutboxEventsPruned,
 		m.CacheHits,
 		m.CacheMisses,
+		m.CacheInvalidationsSent,
+		m.CacheInvalidationsReceived,
+		m.CircuitBreakerState,
+		m.CacheWarmupDuration,
+		m.CacheWarmupOrders,
 	)
 
 	return m
@@ -0,0 +1,126 @@
+package mycache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"orders/src/circuitbreaker"
+	"orders/src/config"
+	"orders/src/metrics"
+	"time"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// ErrCacheMiss — ключа нет в кеше
+var ErrCacheMiss = cache.ErrCacheMiss
+
+const breakerName = "redis"
+
+func newBreaker(cfg config.Breaker, m *metrics.Metrics, log *slog.Logger) *circuitbreaker.Breaker {
+	m.CircuitBreakerState.WithLabelValues(breakerName).Set(float64(circuitbreaker.Closed))
+
+	return circuitbreaker.New(circuitbreaker.Settings{
+		Name:             breakerName,
+		FailureThreshold: cfg.FailureThreshold,
+		OpenTimeout:      cfg.OpenTimeout,
+		OnStateChange: func(name string, from, to circuitbreaker.State) {
+			log.Warn("circuit breaker state changed", "breaker", name, "from", from.String(), "to", to.String())
+			m.CircuitBreakerState.WithLabelValues(name).Set(float64(to))
+		},
+	})
+}
+
+// isRedisFailure: промах и отмена запроса клиентом говорят о том, что Redis доступен
+func isRedisFailure(err error) bool {
+	return !errors.Is(err, cache.ErrCacheMiss) && !errors.Is(err, context.Canceled)
+}
+
+// call не трогает Redis, пока автомат не закрыт: пробные вызовы в half-open делает только probe
+func (r *redisService) call(remote, fallback func() error) error {
+	if r.breaker.State() != circuitbreaker.Closed {
+		return fallback()
+	}
+
+	err := r.breaker.Execute(remote, isRedisFailure)
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		return fallback()
+	}
+
+	return err
+}
+
+// deferDelete запоминает ключи с устаревшими копиями в Redis и у других инстансов; удаление повторяет probe
+func (r *redisService) deferDelete(keys ...string) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+
+	for _, key := range keys {
+		r.pending[key] = struct{}{}
+	}
+}
+
+// probe при закрытом автомате еще и повторяет отложенные удаления
+func (r *redisService) probe(interval time.Duration) {
+	defer close(r.probeDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if r.breaker.State() == circuitbreaker.Closed {
+			r.flushPending()
+			continue
+		}
+
+		done, err := r.breaker.Allow()
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err = r.rdb.Ping(ctx).Err()
+		cancel()
+
+		done(err == nil)
+
+		if err == nil {
+			r.flushPending()
+		}
+	}
+}
+
+func (r *redisService) flushPending() {
+	r.pendingMu.Lock()
+	keys := make([]string, 0, len(r.pending))
+	for key := range r.pending {
+		keys = append(keys, key)
+	}
+	clear(r.pending)
+	r.pendingMu.Unlock()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.rdb.Del(ctx, keys...).Err(); err != nil {
+		r.log.Error("deferred cache delete failed", "keys", len(keys), "error", err)
+		r.deferDelete(keys...)
+
+		return
+	}
+
+	if err := r.broadcast(ctx, keys...); err != nil {
+		r.log.Error("deferred cache invalidation failed", "keys", len(keys), "error", err)
+		r.deferDelete(keys...)
+	}
+}
@@ -0,0 +1,58 @@
+package mycache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidation — просьба инстанса Origin выбросить Keys из локальных кешей
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+func (r *redisService) broadcast(ctx context.Context, keys ...string) error {
+	payload, err := json.Marshal(invalidation{Origin: r.id, Keys: keys})
+	if err != nil {
+		return err
+	}
+
+	if err := r.rdb.Publish(ctx, r.channel, payload).Err(); err != nil {
+		return err
+	}
+
+	r.m.CacheInvalidationsSent.Add(float64(len(keys)))
+
+	return nil
+}
+
+// subscribe: пока соединение с Redis потеряно, локальная копия живет не дольше TTL локального кеша
+func (r *redisService) subscribe(sub *redis.PubSub) {
+	defer close(r.subDone)
+
+	for msg := range sub.Channel() {
+		r.handleInvalidation(msg.Payload)
+	}
+}
+
+func (r *redisService) handleInvalidation(payload string) {
+	var msg invalidation
+
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		r.log.Warn("malformed cache invalidation message", "error", err)
+		return
+	}
+
+	// Свои ключи инстанс уже выбросил при отправке
+	if msg.Origin == r.id {
+		return
+	}
+
+	for _, key := range msg.Keys {
+		r.client.DeleteFromLocalCache(key)
+	}
+
+	r.m.CacheInvalidationsReceived.Add(float64(len(msg.Keys)))
+}
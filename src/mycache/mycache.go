@@ -3,9 +3,13 @@ package mycache
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
+	"orders/src/circuitbreaker"
+	"orders/src/config"
+	"orders/src/logger"
 	"orders/src/metrics"
-	"os"
+	randomid "orders/src/utils/random-id"
+	"sync"
 	"time"
 
 	"github.com/go-redis/cache/v9"
@@ -19,28 +23,52 @@ import (
 type CacheService interface {
 	Get(ctx context.Context, key string, value interface{}) error
 	Set(ctx context.Context, key string, value interface{}) error
+	// Delete удаляет ключ из Redis и из локальных кешей всех инстансов
+	Delete(ctx context.Context, key string) error
+	Ping(ctx context.Context) error
 	Close() error
 }
 
 type myRedisCache interface {
 	Get(ctx context.Context, key string, value interface{}) error
 	Set(item *cache.Item) error
+	Delete(ctx context.Context, key string) error
+	DeleteFromLocalCache(key string)
 }
 type redisService struct {
 	client myRedisCache
 	rdb    *redis.Client
 	ttl    time.Duration
 	m      *metrics.Metrics
+	log    *slog.Logger
+
+	// Пока автомат перед Redis открыт, запросы обслуживает local — тот же локальный кеш без Redis
+	breaker   *circuitbreaker.Breaker
+	local     myRedisCache
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+	stop      chan struct{}
+	probeDone chan struct{}
+
+	// Инвалидация локальных кешей других инстансов через Redis pub/sub
+	id      string
+	channel string
+	sub     *redis.PubSub
+	subDone chan struct{}
 }
 
-func NewRedis(tp *trace.TracerProvider, reg prometheus.Registerer, m *metrics.Metrics, ttl time.Duration) CacheService {
-	redisAddr := os.Getenv("REDIS_HOST") + ":" + os.Getenv("REDIS_PORT")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
+func NewRedis(tp *trace.TracerProvider, reg prometheus.Registerer, m *metrics.Metrics, log *slog.Logger, cfg config.Redis) CacheService {
+	log = logger.Component(log, "cache")
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-		DB:       0,
+		Addr:         cfg.Addr(),
+		Username:     cfg.User,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		MaxRetries:   cfg.MaxRetries,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
 	})
 
 	collector := redisprometheus.NewCollector("redis", "client", rdb)
@@ -50,23 +78,48 @@ func NewRedis(tp *trace.TracerProvider, reg prometheus.Registerer, m *metrics.Me
 	redisotel.WithTracerProvider(tp)
 
 	if err := redisotel.InstrumentTracing(rdb); err != nil {
-		log.Printf("Error in InstrumentTracing: %v\n", err)
+		log.Error("instrument redis tracing failed", "error", err)
 	}
 
 	if err := redisotel.InstrumentMetrics(rdb); err != nil {
-		log.Printf("Error in InstrumentMetrics: %v\n", err)
+		log.Error("instrument redis metrics failed", "error", err)
 	}
 
+	localCache := cache.NewTinyLFU(cfg.LocalSize, cfg.LocalTTL)
+
 	mycache := cache.New(&cache.Options{
 		Redis:      rdb,
-		LocalCache: cache.NewTinyLFU(1000, ttl),
+		LocalCache: localCache,
 	})
 
-	return &redisService{client: mycache, rdb: rdb, ttl: time.Hour, m: m}
+	r := &redisService{
+		client:    mycache,
+		rdb:       rdb,
+		ttl:       cfg.TTL,
+		m:         m,
+		log:       log,
+		breaker:   newBreaker(cfg.Breaker, m, log),
+		local:     cache.New(&cache.Options{LocalCache: localCache}),
+		pending:   make(map[string]struct{}),
+		stop:      make(chan struct{}),
+		probeDone: make(chan struct{}),
+		id:        randomid.New(8),
+		channel:   cfg.InvalidationChannel,
+		sub:       rdb.Subscribe(context.Background(), cfg.InvalidationChannel),
+		subDone:   make(chan struct{}),
+	}
+
+	go r.subscribe(r.sub)
+	go r.probe(cfg.ProbeInterval)
+
+	return r
 }
 
 func (r *redisService) Get(ctx context.Context, key string, value interface{}) error {
-	err := r.client.Get(ctx, key, value)
+	err := r.call(
+		func() error { return r.client.Get(ctx, key, value) },
+		func() error { return r.local.Get(ctx, key, value) },
+	)
 
 	if err == nil {
 		r.m.CacheHits.Inc()
@@ -80,16 +133,61 @@ func (r *redisService) Get(ctx context.Context, key string, value interface{}) e
 }
 
 func (r *redisService) Set(ctx context.Context, key string, value interface{}) error {
-	err := r.client.Set(&cache.Item{
+	item := &cache.Item{
 		Ctx:   ctx,
 		Key:   key,
 		Value: &value,
 		TTL:   r.ttl,
-	})
+	}
 
-	return err
+	return r.call(
+		func() error { return r.client.Set(item) },
+		func() error { return r.local.Set(item) },
+	)
+}
+
+// Delete откладывает не удавшиеся удаление из Redis и рассылку, иначе устаревшая копия дожила бы до TTL
+func (r *redisService) Delete(ctx context.Context, key string) error {
+	return r.call(
+		func() error {
+			if err := r.client.Delete(ctx, key); err != nil {
+				r.deferDelete(key)
+				return err
+			}
+
+			if err := r.broadcast(ctx, key); err != nil {
+				r.deferDelete(key)
+				return err
+			}
+
+			return nil
+		},
+		func() error {
+			r.local.DeleteFromLocalCache(key)
+			r.deferDelete(key)
+
+			return nil
+		},
+	)
+}
+
+func (r *redisService) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
 }
 
 func (r *redisService) Close() error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.probeDone
+	}
+
+	if r.sub != nil {
+		if err := r.sub.Close(); err != nil {
+			r.log.Error("close invalidation subscription failed", "error", err)
+		}
+
+		<-r.subDone
+	}
+
 	return r.rdb.Close()
 }
@@ -2,6 +2,9 @@ package mycache
 
 import (
 	"context"
+	"orders/src/circuitbreaker"
+	"orders/src/config"
+	"orders/src/logger"
 	"orders/src/metrics"
 	"testing"
 	"time"
@@ -34,10 +37,14 @@ func newMockRedis() (CacheService, redismock.ClientMock, *metrics.Metrics) {
 	})
 
 	return &redisService{
-		rdb:    db,
-		ttl:    TTL,
-		client: mockcache,
-		m:      m,
+		rdb:     db,
+		ttl:     TTL,
+		client:  mockcache,
+		m:       m,
+		log:     logger.Discard(),
+		breaker: newBreaker(config.Breaker{FailureThreshold: 3, OpenTimeout: time.Minute}, m, logger.Discard()),
+		local:   cache.New(&cache.Options{LocalCache: cache.NewTinyLFU(10, time.Minute)}),
+		pending: make(map[string]struct{}),
 	}, mock, m
 }
 
@@ -92,3 +99,106 @@ func TestClosed(t *testing.T) {
 	require.EqualError(t, redis.ErrClosed, err.Error())
 
 }
+
+func TestDeleteBroadcastsInvalidation(t *testing.T) {
+	ctx := context.Background()
+	service, mock, m := newMockRedis()
+
+	r := service.(*redisService)
+	r.id, r.channel = "instance-a", "orders:cache:invalidate"
+
+	mock.ExpectDel("order_1").SetVal(1)
+	mock.ExpectPublish("orders:cache:invalidate", []byte(`{"origin":"instance-a","keys":["order_1"]}`)).SetVal(1)
+
+	require.NoError(t, service.Delete(ctx, "order_1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, float64(1), testutil.ToFloat64(m.CacheInvalidationsSent))
+}
+
+func TestDeleteDefersFailedStepWhileBreakerClosed(t *testing.T) {
+	ctx := context.Background()
+	service, mock, _ := newMockRedis()
+
+	r := service.(*redisService)
+	r.id, r.channel = "instance-a", "orders:cache:invalidate"
+
+	mock.ExpectDel("order_1").SetErr(redis.ErrClosed)
+	mock.ExpectDel("order_2").SetVal(1)
+	mock.ExpectPublish("orders:cache:invalidate", []byte(`{"origin":"instance-a","keys":["order_2"]}`)).SetErr(redis.ErrClosed)
+
+	require.ErrorIs(t, service.Delete(ctx, "order_1"), redis.ErrClosed)
+	require.ErrorIs(t, service.Delete(ctx, "order_2"), redis.ErrClosed)
+
+	require.Equal(t, circuitbreaker.Closed, r.breaker.State())
+	require.Equal(t, map[string]struct{}{"order_1": {}, "order_2": {}}, r.pending)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleInvalidationEvictsLocalCopy(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMetrics()
+
+	// Только локальный кеш: значение другого инстанса в Redis здесь не нужно
+	local := cache.New(&cache.Options{LocalCache: cache.NewTinyLFU(10, time.Minute)})
+	r := &redisService{client: local, ttl: time.Minute, m: m, log: logger.Discard(), id: "instance-a",
+		breaker: newBreaker(config.Breaker{FailureThreshold: 3, OpenTimeout: time.Minute}, m, logger.Discard())}
+
+	require.NoError(t, r.Set(ctx, "order_1", "cached"))
+	require.NoError(t, r.Set(ctx, "order_2", "cached"))
+
+	// Свое сообщение игнорируется
+	r.handleInvalidation(`{"origin":"instance-a","keys":["order_1"]}`)
+
+	var value string
+	require.NoError(t, r.Get(ctx, "order_1", &value))
+
+	r.handleInvalidation(`{"origin":"instance-b","keys":["order_1"]}`)
+
+	require.ErrorIs(t, r.Get(ctx, "order_1", &value), cache.ErrCacheMiss)
+	require.NoError(t, r.Get(ctx, "order_2", &value))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.CacheInvalidationsReceived))
+}
+
+func TestBreakerServesLocalCacheWhileRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	service, mock, m := newMockRedis()
+
+	r := service.(*redisService)
+
+	for range 3 {
+		mock.ExpectGet("order_1").SetErr(redis.ErrClosed)
+	}
+
+	type order struct{ ID int }
+
+	var value order
+
+	for range 3 {
+		require.ErrorIs(t, service.Get(ctx, "order_1", &value), redis.ErrClosed)
+	}
+
+	require.Equal(t, circuitbreaker.Open, r.breaker.State())
+	require.Equal(t, float64(circuitbreaker.Open), testutil.ToFloat64(m.CircuitBreakerState.WithLabelValues("redis")))
+
+	// Открытый автомат не ходит в Redis: ожиданий у мока больше нет, любой запрос к нему провалил бы тест
+	require.NoError(t, service.Set(ctx, "order_1", order{ID: 1}))
+	require.NoError(t, service.Get(ctx, "order_1", &value))
+	require.Equal(t, order{ID: 1}, value)
+	require.ErrorIs(t, service.Get(ctx, "order_2", &value), ErrCacheMiss)
+
+	// Удаление откладывается до восстановления Redis
+	require.NoError(t, service.Delete(ctx, "order_1"))
+	require.ErrorIs(t, service.Get(ctx, "order_1", &value), ErrCacheMiss)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	r.id, r.channel = "instance-a", "orders:cache:invalidate"
+
+	mock.ExpectDel("order_1").SetVal(1)
+	mock.ExpectPublish("orders:cache:invalidate", []byte(`{"origin":"instance-a","keys":["order_1"]}`)).SetVal(1)
+
+	r.flushPending()
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Empty(t, r.pending)
+}
@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"orders/src/broker"
+	"orders/src/config"
+	"orders/src/db/models"
+	"orders/src/db/repositories"
+	"orders/src/logger"
+	"orders/src/metrics"
+	randomid "orders/src/utils/random-id"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Relay переносит события из таблицы outbox в Kafka. Строка помечается опубликованной только после
+// подтверждения записи брокером, поэтому доставка at-least-once: при сбое между записью и отметкой событие уйдет повторно
+type Relay struct {
+	cfg      config.Outbox
+	owner    string
+	repo     repositories.OutboxRepository
+	producer *broker.Producer
+	metrics  *metrics.Metrics
+	tp       *sdktrace.TracerProvider
+	log      *slog.Logger
+
+	wg sync.WaitGroup
+}
+
+func NewRelay(cfg config.Outbox, repo repositories.OutboxRepository, producer *broker.Producer,
+	metrics *metrics.Metrics, tp *sdktrace.TracerProvider, log *slog.Logger) *Relay {
+	return &Relay{cfg: cfg, owner: randomid.New(8), repo: repo, producer: producer, metrics: metrics, tp: tp,
+		log: logger.Component(log, "outbox-relay")}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		poll := time.NewTicker(r.cfg.PollInterval)
+		defer poll.Stop()
+
+		prune := time.NewTicker(r.cfg.PruneInterval)
+		defer prune.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				r.log.Info("outbox relay stopped")
+				return
+			case <-poll.C:
+				r.drain(ctx)
+			case <-prune.C:
+				r.prune(ctx)
+			}
+		}
+	}()
+}
+
+// drain публикует пачки, пока outbox не опустеет или публикация не упадет
+func (r *Relay) drain(ctx context.Context) {
+	for {
+		published, err := r.publishBatch(ctx)
+
+		if err != nil {
+			if ctx.Err() == nil {
+				r.log.ErrorContext(ctx, "outbox publish failed", "error", err)
+				r.metrics.OutboxPublishErrors.Inc()
+			}
+
+			return
+		}
+
+		if published < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// publishBatch берет пачку короткой транзакцией, публикует ее вне транзакции и отмечает опубликованной.
+// Публикация ограничена арендой: после ее истечения пачку может взять другой инстанс
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	events, err := r.repo.ClaimBatch(ctx, r.owner, r.cfg.Lease, r.cfg.BatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.cfg.Lease)
+	defer cancel()
+
+	if err := r.publish(publishCtx, events); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	if err := r.repo.MarkPublished(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+func (r *Relay) publish(ctx context.Context, events []models.OutboxEvent) error {
+	tr := r.tp.Tracer("orders-outbox")
+
+	messages := make([]kafka.Message, 0, len(events))
+	spans := make([]trace.Span, 0, len(events))
+
+	for _, event := range events {
+		// Публикация продолжает трейс, в котором событие было записано
+		carrier := propagation.MapCarrier{}
+		if err := json.Unmarshal(event.Headers, &carrier); err != nil {
+			r.log.WarnContext(ctx, "malformed outbox trace headers", "event_id", event.ID, "error", err)
+		}
+
+		msgCtx := propagation.TraceContext{}.Extract(ctx, carrier)
+		msgCtx, span := tr.Start(msgCtx, "publish "+event.EventType, trace.WithSpanKind(trace.SpanKindProducer))
+
+		message := kafka.Message{
+			Key:   []byte(event.Key),
+			Value: event.Payload,
+			Headers: []kafka.Header{
+				{Key: broker.HeaderEventID, Value: []byte(strconv.FormatInt(event.ID, 10))},
+				{Key: broker.HeaderEventType, Value: []byte(event.EventType)},
+			},
+		}
+
+		r.producer.Inject(msgCtx, &message)
+
+		messages = append(messages, message)
+		spans = append(spans, span)
+	}
+
+	err := r.producer.Publish(ctx, messages...)
+
+	for _, span := range spans {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "publish failed")
+		}
+
+		span.End()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		r.metrics.OutboxEventsPublished.WithLabelValues(event.EventType).Inc()
+	}
+
+	return nil
+}
+
+func (r *Relay) prune(ctx context.Context) {
+	pruned, err := r.repo.Prune(ctx, time.Now().Add(-r.cfg.Retention))
+
+	if err != nil {
+		r.log.ErrorContext(ctx, "outbox prune failed", "error", err)
+		return
+	}
+
+	r.metrics.OutboxEventsPruned.Add(float64(pruned))
+}
+
+// Close дожидается остановки цикла реле и закрывает producer
+func (r *Relay) Close() error {
+	r.wg.Wait()
+
+	return r.producer.Close()
+}
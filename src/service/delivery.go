@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"orders/src/db/models"
 	"orders/src/db/repositories"
+	"orders/src/logger"
 	"orders/src/mycache"
 	"strconv"
 
@@ -23,23 +24,30 @@ type deliveryService struct {
 	deliveryRepo repositories.DeliveryRepository
 	valid        *validator.Validate
 	g            singleflight.Group
+	log          *slog.Logger
 }
 
-func NewDeliveryService(repo repositories.DeliveryRepository, cache mycache.CacheService, valid *validator.Validate) DeliveryService {
-	return &deliveryService{deliveryRepo: repo, myCache: cache, valid: valid}
+func NewDeliveryService(repo repositories.DeliveryRepository, cache mycache.CacheService, valid *validator.Validate, log *slog.Logger) DeliveryService {
+	return &deliveryService{deliveryRepo: repo, myCache: cache, valid: valid, log: logger.Component(log, "delivery-service")}
 }
 
 func (s *deliveryService) CreateDelivery(ctx context.Context, deliveryDto *models.Delivery) (models.Delivery, error) {
 	if err := s.valid.StructCtx(ctx, deliveryDto); err != nil {
-		log.Printf("ERROR IN VALIDATE: %v\n", err)
+		err = domainError(err, "delivery")
+		logError(ctx, s.log, "validate delivery", err)
 
 		return models.Delivery{}, err
 	}
 
+	if err := rulesError("delivery", checkOrderOwner(deliveryDto.OrderID)); err != nil {
+		return models.Delivery{}, err
+	}
+
 	delivery, err := s.deliveryRepo.CreateDelivery(ctx, deliveryDto)
 
 	if err != nil {
-		log.Printf("ERROR IN CreateDelivery: %v\n", err)
+		err = domainError(err, "delivery")
+		logError(ctx, s.log, "create delivery", err, "order_id", deliveryDto.OrderID)
 
 		return models.Delivery{}, err
 	}
@@ -61,13 +69,13 @@ func (s *deliveryService) GetDeliveryByID(ctx context.Context, deliveryID int) (
 		})
 
 		if err != nil {
-			return models.Delivery{}, err
+			return models.Delivery{}, domainError(err, "delivery")
 		}
 
 		delivery = v.(models.Delivery)
 
 		if err = s.myCache.Set(ctx, redisKey, delivery); err != nil {
-			log.Printf("ERROR IN SET CACHE: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
@@ -90,12 +98,12 @@ func (s *deliveryService) GetDeliveryByOrderID(ctx context.Context, orderID int)
 		})
 
 		if err != nil {
-			return models.Delivery{}, err
+			return models.Delivery{}, domainError(err, "delivery")
 		}
-		delivery := v.(models.Delivery)
+		delivery = v.(models.Delivery)
 
 		if err = s.myCache.Set(ctx, redisKey, delivery); err != nil {
-			log.Printf("ERROR IN SET CACHE: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
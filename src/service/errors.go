@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"orders/src/db"
+	"orders/src/db/repositories"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Классы ошибок предметной области. Проверяются через errors.Is, HTTP-слой отображает их в статусы
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrConflict     = errors.New("conflict")
+	ErrUnavailable  = errors.New("temporarily unavailable")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// FieldError — нарушение правила валидации в одном поле
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error — ошибка предметной области. Message можно отдавать клиенту, Err — исходная причина только для логов
+type Error struct {
+	Kind    error
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func NewError(kind error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+
+	return []error{e.Kind}
+}
+
+// domainError переводит ошибки валидатора и репозиториев в Error; subject описывает искомую сущность
+// для сообщения клиенту. Неизвестные ошибки возвращаются как есть
+func domainError(err error, subject string) error {
+	if err == nil {
+		return nil
+	}
+
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return err
+	}
+
+	var validationErrs validator.ValidationErrors
+
+	switch {
+	case errors.As(err, &validationErrs):
+		return &Error{Kind: ErrValidation, Message: subject + " is invalid", Fields: fieldErrors(validationErrs), Err: err}
+	case errors.Is(err, repositories.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return &Error{Kind: ErrNotFound, Message: subject + " not found", Err: err}
+	case errors.Is(err, repositories.ErrConflict):
+		return &Error{Kind: ErrConflict, Message: subject + " conflicts with an existing order", Err: err}
+	case errors.Is(err, repositories.ErrStatusChanged):
+		return &Error{Kind: ErrConflict, Message: subject + " status was changed concurrently, retry", Err: err}
+	case db.IsUniqueViolation(err):
+		return &Error{Kind: ErrConflict, Message: subject + " conflicts with an existing record", Err: err}
+	case db.IsCheckViolation(err):
+		constraint := db.ConstraintName(err)
+		return &Error{Kind: ErrValidation, Message: subject + " is invalid", Err: err,
+			Fields: []FieldError{{Field: constraint, Rule: "check", Message: "violates constraint " + constraint}}}
+	case errors.Is(err, db.ErrUnavailable), errors.Is(err, context.DeadlineExceeded), db.IsRetryable(err):
+		return &Error{Kind: ErrUnavailable, Message: "storage is temporarily unavailable", Err: err}
+	}
+
+	return err
+}
+
+// logError пишет ошибку операции с уровнем по ее классу: отсутствие записи — debug, невалидные данные и конфликт — warn
+// (причина в запросе или сообщении, а не в сервисе), остальное — error. err уже переведена domainError
+func logError(ctx context.Context, log *slog.Logger, msg string, err error, args ...any) {
+	level := slog.LevelError
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		level = slog.LevelDebug
+	case errors.Is(err, ErrValidation), errors.Is(err, ErrConflict):
+		level = slog.LevelWarn
+	}
+
+	log.Log(ctx, level, msg, append(args, "error", err)...)
+}
+
+func fieldErrors(errs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(errs))
+
+	for _, e := range errs {
+		// Namespace начинается с имени корневой структуры (OrderMessage.Items[0].Price) — клиенту оно не нужно
+		field := e.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    e.Tag(),
+			Message: fieldMessage(e),
+		})
+	}
+
+	return fields
+}
+
+func fieldMessage(e validator.FieldError) string {
+	switch {
+	case e.Tag() == "required":
+		return "is required"
+	case e.Param() != "":
+		return fmt.Sprintf("must satisfy %s=%s", e.Tag(), e.Param())
+	default:
+		return "must be a valid " + e.Tag()
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"orders/src/db"
+	"orders/src/db/repositories"
+	customvalidator "orders/src/utils/custom-validator"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+type validated struct {
+	Name  string `validate:"required"`
+	Email string `validate:"email"`
+}
+
+func TestDomainError_Kinds(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{fmt.Errorf("get: %w", repositories.ErrNotFound), ErrNotFound},
+		{fmt.Errorf("create: %w", repositories.ErrConflict), ErrConflict},
+		{context.DeadlineExceeded, ErrUnavailable},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, ErrUnavailable},
+		{fmt.Errorf("%w: circuit breaker is open", db.ErrUnavailable), ErrUnavailable},
+		{&pgconn.PgError{Code: "23505", ConstraintName: "payment_transaction_key"}, ErrConflict},
+		{&pgconn.PgError{Code: "23514", ConstraintName: "item_sale_check"}, ErrValidation},
+		{&pgconn.PgError{Code: "40001"}, ErrUnavailable},
+	}
+
+	for _, c := range cases {
+		err := domainError(c.err, "order 1")
+
+		require.ErrorIs(t, err, c.kind)
+		require.ErrorIs(t, err, c.err)
+	}
+
+	unknown := errors.New("boom")
+	require.Equal(t, unknown, domainError(unknown, "order 1"))
+	require.NoError(t, domainError(nil, "order 1"))
+}
+
+func TestDomainError_ValidationFields(t *testing.T) {
+	valid, err := customvalidator.NewValidator()
+	require.NoError(t, err)
+
+	err = domainError(valid.Struct(validated{Email: "nope"}), "order")
+
+	var domainErr *Error
+	require.ErrorAs(t, err, &domainErr)
+	require.ErrorIs(t, err, ErrValidation)
+	require.Equal(t, []FieldError{
+		{Field: "Name", Rule: "required", Message: "is required"},
+		{Field: "Email", Rule: "email", Message: "must be a valid email"},
+	}, domainErr.Fields)
+
+	// Уже переведенная ошибка не оборачивается повторно
+	require.Same(t, domainErr, domainError(domainErr, "orders"))
+}
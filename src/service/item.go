@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"orders/src/db/models"
 	"orders/src/db/repositories"
+	"orders/src/logger"
 	"orders/src/mycache"
 	"strconv"
 
@@ -23,24 +24,30 @@ type itemService struct {
 	itemRepo repositories.ItemRepository
 	valid    *validator.Validate
 	g        singleflight.Group
+	log      *slog.Logger
 }
 
-func NewItemService(repo repositories.ItemRepository, cache mycache.CacheService, valid *validator.Validate) ItemService {
-
-	return &itemService{itemRepo: repo, myCache: cache, valid: valid}
+func NewItemService(repo repositories.ItemRepository, cache mycache.CacheService, valid *validator.Validate, log *slog.Logger) ItemService {
+	return &itemService{itemRepo: repo, myCache: cache, valid: valid, log: logger.Component(log, "item-service")}
 }
 
 func (s *itemService) CreateItem(ctx context.Context, itemDto *models.Item) (models.Item, error) {
 	if err := s.valid.StructCtx(ctx, itemDto); err != nil {
-		log.Printf("ERROR IN VALIDATE: %v\n", err)
+		err = domainError(err, "item")
+		logError(ctx, s.log, "validate item", err)
+
+		return models.Item{}, err
+	}
 
+	if err := rulesError("item", append(checkItemRules(itemDto, ""), checkOrderOwner(itemDto.OrderID)...)); err != nil {
 		return models.Item{}, err
 	}
 
 	item, err := s.itemRepo.CreateItem(ctx, itemDto)
 
 	if err != nil {
-		log.Printf("ERROR IN CreateItem: %v\n", err)
+		err = domainError(err, "item")
+		logError(ctx, s.log, "create item", err, "order_id", itemDto.OrderID)
 
 		return models.Item{}, err
 	}
@@ -62,13 +69,13 @@ func (s *itemService) GetItemByID(ctx context.Context, itemID int) (models.Item,
 		})
 
 		if err != nil {
-			return models.Item{}, err
+			return models.Item{}, domainError(err, "item")
 		}
 
 		item := v.(models.Item)
 
 		if err = s.myCache.Set(ctx, redisKey, item); err != nil {
-			log.Printf("ERROR IN PAYMENT CACHE SET: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
@@ -91,13 +98,13 @@ func (s *itemService) GetItemsByOrderID(ctx context.Context, orderID int) ([]mod
 		})
 
 		if err != nil {
-			return []models.Item{}, err
+			return []models.Item{}, domainError(err, "items")
 		}
 
 		items = v.([]models.Item)
 
 		if err = s.myCache.Set(ctx, redisKey, items); err != nil {
-			log.Printf("ERROR IN PAYMENT CACHE SET: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
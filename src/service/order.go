@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"orders/src/broker"
 	"orders/src/db/models"
 	"orders/src/db/repositories"
+	"orders/src/logger"
 	"orders/src/mycache"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"golang.org/x/sync/singleflight"
@@ -15,7 +19,34 @@ import (
 
 type OrderService interface {
 	GetOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error)
+	GetOrderByUID(ctx context.Context, orderUID string) (*broker.OrderMessage, error)
 	CreateOrder(ctx context.Context, orderDto models.Order) (models.Order, error)
+	CreateOrderAggregate(ctx context.Context, orderDto *broker.OrderMessage) (*broker.OrderMessage, error)
+	CreateOrderAggregates(ctx context.Context, orderDtos []*broker.OrderMessage) ([]*broker.OrderMessage, error)
+	ListOrders(ctx context.Context, filter repositories.OrderFilter) (*OrderPage, error)
+	WarmUpCache(ctx context.Context, opts WarmUpOptions) (int, error)
+	ChangeStatus(ctx context.Context, orderID int, req StatusChangeRequest) (models.StatusChange, error)
+	GetStatusHistory(ctx context.Context, orderID int) (*StatusHistory, error)
+}
+
+// Размер страницы списка заказов
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// OrderPage — страница списка заказов; NextCursor пуст на последней странице
+type OrderPage struct {
+	Orders     []*broker.OrderMessage `json:"orders"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// WarmUpOptions — какие заказы загрузить в кеш при старте: не больше Limit последних
+// и не старше Window (0 — без ограничения по времени), пачками по BatchSize
+type WarmUpOptions struct {
+	Limit     int
+	Window    time.Duration
+	BatchSize int
 }
 
 type orderService struct {
@@ -23,15 +54,26 @@ type orderService struct {
 	orderRepo repositories.OrderRepository
 	valid     *validator.Validate
 	g         singleflight.Group
+	log       *slog.Logger
 }
 
 func NewOrderService(
-	orderRepo repositories.OrderRepository, myCache mycache.CacheService, valid *validator.Validate) OrderService {
-	return &orderService{myCache: myCache, orderRepo: orderRepo, valid: valid}
+	orderRepo repositories.OrderRepository, myCache mycache.CacheService, valid *validator.Validate, log *slog.Logger) OrderService {
+	return &orderService{myCache: myCache, orderRepo: orderRepo, valid: valid, log: logger.Component(log, "order-service")}
+}
+
+func orderCacheKey(orderID int) string {
+	return "order_" + strconv.Itoa(orderID)
+}
+
+// orderUIDCacheKey — ключ связи order_uid -> id. Связь неизменна, а сам агрегат кешируется только под id,
+// поэтому инвалидация ключа по id действует и на поиск по order_uid
+func orderUIDCacheKey(orderUID string) string {
+	return "order_uid_" + orderUID
 }
 
 func (s *orderService) GetOrderByID(ctx context.Context, orderID int) (*broker.OrderMessage, error) {
-	redisKey := "order_" + strconv.Itoa(orderID)
+	redisKey := orderCacheKey(orderID)
 
 	var order *broker.OrderMessage
 
@@ -41,7 +83,10 @@ func (s *orderService) GetOrderByID(ctx context.Context, orderID int) (*broker.O
 		return order, nil
 	}
 
-	log.Printf("ERROR IN REDIS: %v\n", err)
+	// Промах — обычный путь; при недоступном Redis кеш сам переходит на локальную копию
+	if !errors.Is(err, mycache.ErrCacheMiss) {
+		s.log.WarnContext(ctx, "cache get failed", "key", redisKey, "error", err)
+	}
 
 	v, err, _ := s.g.Do(redisKey, func() (interface{}, error) {
 		return s.orderRepo.GetOrderByID(ctx, orderID)
@@ -49,33 +94,205 @@ func (s *orderService) GetOrderByID(ctx context.Context, orderID int) (*broker.O
 	})
 
 	if err != nil {
-		log.Printf("ERROR IN DB: %v\n", err)
-		return order, err
+		err = domainError(err, fmt.Sprintf("order %d", orderID))
+		logError(ctx, s.log, "get order", err, "order_id", orderID)
+
+		return nil, err
 	}
 
 	order = v.(*broker.OrderMessage)
 
-	if err = s.myCache.Set(ctx, redisKey, order); err != nil {
-		log.Printf("Error in Cache Set %v\n", err)
-	}
+	s.cacheOrder(ctx, order)
 
 	s.g.Forget(redisKey)
 
 	return order, nil
 }
 
+func (s *orderService) GetOrderByUID(ctx context.Context, orderUID string) (*broker.OrderMessage, error) {
+	ctx = logger.WithAttrs(ctx, logger.OrderUID(orderUID))
+
+	uidKey := orderUIDCacheKey(orderUID)
+
+	var orderID int
+
+	if err := s.myCache.Get(ctx, uidKey, &orderID); err == nil {
+		return s.GetOrderByID(ctx, orderID)
+	}
+
+	v, err, _ := s.g.Do(uidKey, func() (interface{}, error) {
+		return s.orderRepo.GetOrderByUID(ctx, orderUID)
+	})
+
+	if err != nil {
+		err = domainError(err, fmt.Sprintf("order %s", orderUID))
+		logError(ctx, s.log, "get order", err)
+
+		return nil, err
+	}
+
+	order := v.(*broker.OrderMessage)
+
+	s.cacheOrder(ctx, order)
+
+	s.g.Forget(uidKey)
+
+	return order, nil
+}
+
+// cacheOrder кладет агрегат под ключом id и связь order_uid -> id
+func (s *orderService) cacheOrder(ctx context.Context, order *broker.OrderMessage) {
+	if err := s.myCache.Set(ctx, orderCacheKey(order.ID), order); err != nil {
+		s.log.WarnContext(ctx, "cache set failed", "key", orderCacheKey(order.ID), "error", err)
+	}
+
+	if err := s.myCache.Set(ctx, orderUIDCacheKey(order.OrderUID), order.ID); err != nil {
+		s.log.WarnContext(ctx, "cache set failed", "key", orderUIDCacheKey(order.OrderUID), "error", err)
+	}
+}
+
 func (s *orderService) CreateOrder(ctx context.Context, orderDto models.Order) (models.Order, error) {
 	if err := s.valid.StructCtx(ctx, orderDto); err != nil {
-		return models.Order{}, err
+		return models.Order{}, domainError(err, "order")
 	}
 
 	order, err := s.orderRepo.CreateOrder(ctx, &orderDto)
 
 	if err != nil {
-		log.Printf("Error in CreateOrder: %v\n", err)
+		err = domainError(err, "order "+orderDto.OrderUID)
+		logError(ctx, s.log, "create order", err)
+
 		return models.Order{}, err
 	}
 
 	return order, nil
 
 }
+
+// CreateOrderAggregate сохраняет заказ вместе с доставкой, оплатой и товарами атомарно.
+// order_id доставки, оплаты и товаров проставляет репозиторий после вставки заказа.
+// После проверки форматов полей проверяется согласованность сумм, товаров и дат (rules.go)
+func (s *orderService) CreateOrderAggregate(ctx context.Context, orderDto *broker.OrderMessage) (*broker.OrderMessage, error) {
+	if err := s.valid.StructCtx(ctx, orderDto); err != nil {
+		return nil, domainError(err, "order "+orderDto.OrderUID)
+	}
+
+	if err := rulesError("order "+orderDto.OrderUID, checkOrderRules(orderDto, time.Now())); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orderRepo.CreateOrderAggregate(ctx, orderDto)
+
+	if err != nil {
+		err = domainError(err, "order "+orderDto.OrderUID)
+		logError(ctx, s.log, "create order aggregate", err)
+
+		return nil, err
+	}
+
+	s.log.DebugContext(ctx, "order saved", "order_id", order.ID, "items", len(order.Items))
+
+	return order, nil
+}
+
+// CreateOrderAggregates сохраняет пачку агрегатов одной транзакцией. Пачка принимается целиком или не принимается:
+// первый же заказ, не прошедший проверки, или ошибка записи возвращаются как ошибка всей пачки,
+// и вызывающий сохраняет заказы по одному через CreateOrderAggregate, чтобы отделить виновника
+func (s *orderService) CreateOrderAggregates(ctx context.Context, orderDtos []*broker.OrderMessage) ([]*broker.OrderMessage, error) {
+	now := time.Now()
+
+	for _, orderDto := range orderDtos {
+		if err := s.valid.StructCtx(ctx, orderDto); err != nil {
+			return nil, domainError(err, "order "+orderDto.OrderUID)
+		}
+
+		if err := rulesError("order "+orderDto.OrderUID, checkOrderRules(orderDto, now)); err != nil {
+			return nil, err
+		}
+	}
+
+	orders, err := s.orderRepo.CreateOrderAggregates(ctx, orderDtos)
+
+	if err != nil {
+		err = domainError(err, "order batch")
+		logError(ctx, s.log, "create order aggregates", err, "size", len(orderDtos))
+
+		return nil, err
+	}
+
+	s.log.DebugContext(ctx, "order batch saved", "size", len(orderDtos), "created", len(orders))
+
+	return orders, nil
+}
+
+// ListOrders возвращает страницу заказов от новых к старым. Читается на один заказ больше страницы,
+// чтобы понять, есть ли следующая
+func (s *orderService) ListOrders(ctx context.Context, filter repositories.OrderFilter) (*OrderPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+
+	filter.Limit = min(filter.Limit, maxPageSize)
+	pageSize := filter.Limit
+	filter.Limit++
+
+	orders, err := s.orderRepo.ListOrders(ctx, filter)
+
+	if err != nil {
+		err = domainError(err, "orders")
+		logError(ctx, s.log, "list orders", err)
+
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+
+	if len(orders) > pageSize {
+		page.Orders = orders[:pageSize]
+
+		last := page.Orders[pageSize-1]
+		page.NextCursor = repositories.OrderCursor{DateCreated: last.DateCreated, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// WarmUpCache загружает последние заказы в кеш пачками и возвращает, сколько заказов прогрето
+func (s *orderService) WarmUpCache(ctx context.Context, opts WarmUpOptions) (int, error) {
+	var since time.Time
+
+	if opts.Window > 0 {
+		since = time.Now().Add(-opts.Window)
+	}
+
+	var cursor *repositories.OrderCursor
+
+	warmed := 0
+
+	for warmed < opts.Limit {
+		batch := min(opts.BatchSize, opts.Limit-warmed)
+
+		orders, err := s.orderRepo.ListOrders(ctx, repositories.OrderFilter{DateFrom: since, After: cursor, Limit: batch})
+
+		if err != nil {
+			return warmed, err
+		}
+
+		for _, order := range orders {
+			s.cacheOrder(ctx, order)
+		}
+
+		warmed += len(orders)
+
+		s.log.InfoContext(ctx, "cache warm-up progress", "warmed", warmed, "limit", opts.Limit)
+
+		if len(orders) < batch {
+			break
+		}
+
+		last := orders[len(orders)-1]
+		cursor = &repositories.OrderCursor{DateCreated: last.DateCreated, ID: last.ID}
+	}
+
+	return warmed, nil
+}
@@ -2,11 +2,13 @@ package service
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"orders/src/db/models"
 	"orders/src/db/repositories"
+	"orders/src/logger"
 	"orders/src/mycache"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"golang.org/x/sync/singleflight"
@@ -23,23 +25,30 @@ type paymentService struct {
 	paymentRepo repositories.PaymentRepository
 	valid       *validator.Validate
 	g           singleflight.Group
+	log         *slog.Logger
 }
 
-func NewPaymentService(repo repositories.PaymentRepository, cache mycache.CacheService, valid *validator.Validate) PaymentService {
-	return &paymentService{paymentRepo: repo, myCache: cache, valid: valid}
+func NewPaymentService(repo repositories.PaymentRepository, cache mycache.CacheService, valid *validator.Validate, log *slog.Logger) PaymentService {
+	return &paymentService{paymentRepo: repo, myCache: cache, valid: valid, log: logger.Component(log, "payment-service")}
 }
 
 func (s *paymentService) CreatePayment(ctx context.Context, paymentDto *models.Payment) (models.Payment, error) {
 	if err := s.valid.StructCtx(ctx, paymentDto); err != nil {
-		log.Printf("ERROR IN VALIDATE: %v\n", err)
+		err = domainError(err, "payment")
+		logError(ctx, s.log, "validate payment", err)
 
 		return models.Payment{}, err
 	}
 
+	if err := rulesError("payment", append(checkPaymentRules(paymentDto, "", time.Now()), checkOrderOwner(paymentDto.OrderID)...)); err != nil {
+		return models.Payment{}, err
+	}
+
 	payment, err := s.paymentRepo.CreatePayment(ctx, paymentDto)
 
 	if err != nil {
-		log.Printf("ERROR IN CreatePayment: %v\n", err)
+		err = domainError(err, "payment")
+		logError(ctx, s.log, "create payment", err, "order_id", paymentDto.OrderID)
 
 		return models.Payment{}, err
 	}
@@ -61,13 +70,13 @@ func (s *paymentService) GetPaymentByID(ctx context.Context, paymentID int) (mod
 		})
 
 		if err != nil {
-			return models.Payment{}, err
+			return models.Payment{}, domainError(err, "payment")
 		}
 
 		payment = v.(models.Payment)
 
 		if err = s.myCache.Set(ctx, redisKey, payment); err != nil {
-			log.Printf("ERROR IN SET CACHE: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
@@ -90,13 +99,13 @@ func (s *paymentService) GetPaymentByOrderID(ctx context.Context, orderID int) (
 		})
 
 		if err != nil {
-			return models.Payment{}, err
+			return models.Payment{}, domainError(err, "payment")
 		}
 
 		payment = v.(models.Payment)
 
 		if err = s.myCache.Set(ctx, redisKey, payment); err != nil {
-			log.Printf("ERROR IN SET CACHE: %v\n", err)
+			s.log.WarnContext(ctx, "cache set failed", "key", redisKey, "error", err)
 		}
 
 		s.g.Forget(redisKey)
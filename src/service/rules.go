@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+	"orders/src/broker"
+	"orders/src/db/models"
+	"time"
+)
+
+// Допуски бизнес-правил
+const (
+	// totalPriceTolerance — расхождение total_price с ценой со скидкой из-за округления, в минимальных единицах валюты
+	totalPriceTolerance = 1
+
+	// paymentClockSkew — насколько payment_dt может опережать часы сервиса
+	paymentClockSkew = 5 * time.Minute
+
+	// paymentBeforeCreated — насколько оплата может предшествовать созданию заказа
+	paymentBeforeCreated = 24 * time.Hour
+)
+
+// Названия нарушенных правил в FieldError.Rule
+const (
+	ruleGoodsTotal      = "goods_total_sum"
+	ruleAmount          = "amount_sum"
+	ruleTrackNumber     = "track_number_match"
+	ruleSaleRange       = "sale_range"
+	ruleTotalPrice      = "total_price_sale"
+	rulePaymentInFuture = "payment_dt_future"
+	rulePaymentTooEarly = "payment_dt_before_created"
+	ruleOrderRequired   = "order_id_required"
+)
+
+// checkOrderRules проверяет согласованность агрегата заказа и возвращает все нарушения.
+// Имена полей совпадают с ошибками валидатора: Payment.GoodsTotal, Items[0].TotalPrice
+func checkOrderRules(order *broker.OrderMessage, now time.Time) []FieldError {
+	violations := checkPaymentRules(&order.Payment, "Payment.", now)
+
+	goodsTotal := 0
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		prefix := fmt.Sprintf("Items[%d].", i)
+
+		goodsTotal += item.TotalPrice
+
+		violations = append(violations, checkItemRules(item, prefix)...)
+
+		if item.TrackNumber != order.TrackNumber {
+			violations = append(violations, FieldError{
+				Field:   prefix + "TrackNumber",
+				Rule:    ruleTrackNumber,
+				Message: fmt.Sprintf("must match order track_number %q, got %q", order.TrackNumber, item.TrackNumber),
+			})
+		}
+	}
+
+	if order.Payment.GoodsTotal != goodsTotal {
+		violations = append(violations, FieldError{
+			Field:   "Payment.GoodsTotal",
+			Rule:    ruleGoodsTotal,
+			Message: fmt.Sprintf("must equal sum of items total_price %d, got %d", goodsTotal, order.Payment.GoodsTotal),
+		})
+	}
+
+	paidAt := time.Unix(int64(order.Payment.PaymentDt), 0)
+
+	if !order.DateCreated.IsZero() && paidAt.Before(order.DateCreated.Add(-paymentBeforeCreated)) {
+		violations = append(violations, FieldError{
+			Field:   "Payment.PaymentDt",
+			Rule:    rulePaymentTooEarly,
+			Message: fmt.Sprintf("must not be more than %s before date_created %s", paymentBeforeCreated, order.DateCreated.Format(time.RFC3339)),
+		})
+	}
+
+	return violations
+}
+
+// checkPaymentRules — правила, которые проверяются по одной оплате
+func checkPaymentRules(payment *models.Payment, prefix string, now time.Time) []FieldError {
+	var violations []FieldError
+
+	if expected := payment.GoodsTotal + payment.DeliveryCost + payment.CustomFee; payment.Amount != expected {
+		violations = append(violations, FieldError{
+			Field:   prefix + "Amount",
+			Rule:    ruleAmount,
+			Message: fmt.Sprintf("must equal goods_total + delivery_cost + custom_fee = %d, got %d", expected, payment.Amount),
+		})
+	}
+
+	if paidAt := time.Unix(int64(payment.PaymentDt), 0); paidAt.After(now.Add(paymentClockSkew)) {
+		violations = append(violations, FieldError{
+			Field:   prefix + "PaymentDt",
+			Rule:    rulePaymentInFuture,
+			Message: fmt.Sprintf("must not be in the future, got %s", paidAt.UTC().Format(time.RFC3339)),
+		})
+	}
+
+	return violations
+}
+
+// checkItemRules — правила, которые проверяются по одному товару: скидка в процентах и итоговая цена
+func checkItemRules(item *models.Item, prefix string) []FieldError {
+	if item.Sale < 0 || item.Sale > 100 {
+		return []FieldError{{
+			Field:   prefix + "Sale",
+			Rule:    ruleSaleRange,
+			Message: fmt.Sprintf("must be between 0 and 100, got %d", item.Sale),
+		}}
+	}
+
+	expected := item.Price * (100 - item.Sale) / 100
+
+	if diff := item.TotalPrice - expected; diff > totalPriceTolerance || diff < -totalPriceTolerance {
+		return []FieldError{{
+			Field:   prefix + "TotalPrice",
+			Rule:    ruleTotalPrice,
+			Message: fmt.Sprintf("must equal price with sale %d, got %d", expected, item.TotalPrice),
+		}}
+	}
+
+	return nil
+}
+
+// checkOrderOwner — доставка, оплата или товар, присланные отдельным сообщением, должны ссылаться на заказ:
+// дочерняя запись без заказа в схеме невозможна
+func checkOrderOwner(orderID int) []FieldError {
+	if orderID > 0 {
+		return nil
+	}
+
+	return []FieldError{{
+		Field:   "OrderID",
+		Rule:    ruleOrderRequired,
+		Message: "must reference an existing order",
+	}}
+}
+
+// rulesError собирает нарушения бизнес-правил в ошибку валидации; nil, если нарушений нет
+func rulesError(subject string, violations []FieldError) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &Error{Kind: ErrValidation, Message: subject + " violates business rules", Fields: violations}
+}
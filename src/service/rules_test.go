@@ -0,0 +1,90 @@
+package service
+
+import (
+	"orders/src/broker"
+	"orders/src/db/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var rulesNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func validOrder() *broker.OrderMessage {
+	return &broker.OrderMessage{
+		Order: models.Order{
+			OrderUID:    "b563feb7b2b84b6test",
+			TrackNumber: "WBILMTESTTRACK",
+			DateCreated: rulesNow.Add(-time.Hour),
+		},
+		Payment: models.Payment{
+			Amount:       1817,
+			PaymentDt:    int(rulesNow.Add(-time.Hour).Unix()),
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+			CustomFee:    0,
+		},
+		Items: []models.Item{
+			{TrackNumber: "WBILMTESTTRACK", Price: 453, Sale: 30, TotalPrice: 317},
+		},
+	}
+}
+
+func rules(violations []FieldError) map[string]string {
+	result := make(map[string]string, len(violations))
+
+	for _, v := range violations {
+		result[v.Field] = v.Rule
+	}
+
+	return result
+}
+
+func TestCheckOrderRules_Valid(t *testing.T) {
+	require.Empty(t, checkOrderRules(validOrder(), rulesNow))
+}
+
+func TestCheckOrderRules_ReportsEveryViolation(t *testing.T) {
+	order := validOrder()
+	order.Payment.GoodsTotal = 400
+	order.Payment.PaymentDt = int(rulesNow.Add(time.Hour).Unix())
+	order.Items = append(order.Items,
+		models.Item{TrackNumber: "OTHER", Price: 100, Sale: 10, TotalPrice: 50},
+		models.Item{TrackNumber: "WBILMTESTTRACK", Price: 100, Sale: 120, TotalPrice: 0},
+	)
+
+	require.Equal(t, map[string]string{
+		"Payment.Amount":       ruleAmount,
+		"Payment.PaymentDt":    rulePaymentInFuture,
+		"Payment.GoodsTotal":   ruleGoodsTotal,
+		"Items[1].TrackNumber": ruleTrackNumber,
+		"Items[1].TotalPrice":  ruleTotalPrice,
+		"Items[2].Sale":        ruleSaleRange,
+	}, rules(checkOrderRules(order, rulesNow)))
+}
+
+func TestCheckOrderRules_PaymentLongBeforeCreation(t *testing.T) {
+	order := validOrder()
+	order.Payment.PaymentDt = int(order.DateCreated.Add(-48 * time.Hour).Unix())
+
+	require.Equal(t, map[string]string{"Payment.PaymentDt": rulePaymentTooEarly}, rules(checkOrderRules(order, rulesNow)))
+}
+
+func TestCheckItemRules_RoundingTolerance(t *testing.T) {
+	// 453 * 70 / 100 = 317.1: округление в любую сторону допустимо
+	require.Empty(t, checkItemRules(&models.Item{Price: 453, Sale: 30, TotalPrice: 318}, ""))
+	require.Len(t, checkItemRules(&models.Item{Price: 453, Sale: 30, TotalPrice: 319}, ""), 1)
+}
+
+func TestCheckOrderOwner(t *testing.T) {
+	require.Empty(t, checkOrderOwner(1001))
+	require.Equal(t, map[string]string{"OrderID": ruleOrderRequired}, rules(checkOrderOwner(0)))
+}
+
+func TestRulesError(t *testing.T) {
+	require.NoError(t, rulesError("order", nil))
+
+	err := rulesError("order", []FieldError{{Field: "Payment.Amount", Rule: ruleAmount}})
+	require.ErrorIs(t, err, ErrValidation)
+}
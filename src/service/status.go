@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"orders/src/db/models"
+)
+
+// transitions — допустимые переходы статусов заказа. cancelled и returned конечные
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.StatusCreated:    {models.StatusPaid, models.StatusCancelled},
+	models.StatusPaid:       {models.StatusAssembling, models.StatusCancelled},
+	models.StatusAssembling: {models.StatusShipped, models.StatusCancelled},
+	models.StatusShipped:    {models.StatusDelivered, models.StatusReturned},
+	models.StatusDelivered:  {models.StatusReturned},
+	models.StatusCancelled:  nil,
+	models.StatusReturned:   nil,
+}
+
+// KnownStatus сообщает, есть ли такой статус в жизненном цикле заказа
+func KnownStatus(status models.OrderStatus) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanTransition сообщает, можно ли перевести заказ из статуса from в статус to
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusChangeRequest — запрос на смену статуса: новый статус, кто меняет и почему.
+// Actor не читается из тела: HTTP-слой берет его из токена клиента
+type StatusChangeRequest struct {
+	Status models.OrderStatus `json:"status" validate:"required"`
+	Actor  string             `json:"-" validate:"required,max=255"`
+	Reason string             `json:"reason"`
+}
+
+// StatusHistory — текущий статус заказа и все переходы от старых к новым
+type StatusHistory struct {
+	OrderID int                   `json:"order_id"`
+	Status  models.OrderStatus    `json:"status"`
+	History []models.StatusChange `json:"history"`
+}
+
+// ChangeStatus переводит заказ в новый статус. Недопустимый переход — ErrConflict.
+// Статус читается из БД, а не из кеша, и меняется, только если его не успели сменить параллельно
+func (s *orderService) ChangeStatus(ctx context.Context, orderID int, req StatusChangeRequest) (models.StatusChange, error) {
+	subject := fmt.Sprintf("order %d", orderID)
+
+	if err := s.valid.StructCtx(ctx, req); err != nil {
+		return models.StatusChange{}, domainError(err, "status change")
+	}
+
+	if !KnownStatus(req.Status) {
+		return models.StatusChange{}, &Error{
+			Kind:    ErrValidation,
+			Message: "status change is invalid",
+			Fields:  []FieldError{{Field: "Status", Rule: "status", Message: fmt.Sprintf("unknown status %q", req.Status)}},
+		}
+	}
+
+	order, err := s.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return models.StatusChange{}, domainError(err, subject)
+	}
+
+	if !CanTransition(order.Status, req.Status) {
+		return models.StatusChange{}, NewError(ErrConflict, "%s: transition %s -> %s is not allowed", subject, order.Status, req.Status)
+	}
+
+	change, err := s.orderRepo.UpdateStatus(ctx, &models.StatusChange{
+		OrderID: orderID,
+		From:    order.Status,
+		To:      req.Status,
+		Actor:   req.Actor,
+		Reason:  req.Reason,
+	})
+
+	if err != nil {
+		err = domainError(err, subject)
+		logError(ctx, s.log, "update status", err, "order_id", orderID)
+
+		return models.StatusChange{}, err
+	}
+
+	s.log.InfoContext(ctx, "order status changed", "order_id", orderID, "from", change.From, "to", change.To, "actor", change.Actor)
+
+	// Связь order_uid -> id не меняется, достаточно сбросить агрегат
+	if err := s.myCache.Delete(ctx, orderCacheKey(orderID)); err != nil {
+		s.log.WarnContext(ctx, "cache delete failed", "key", orderCacheKey(orderID), "error", err)
+	}
+
+	return change, nil
+}
+
+// GetStatusHistory возвращает текущий статус заказа и историю переходов. Оба читаются из БД одной транзакцией:
+// статус из кеша мог отставать от истории
+func (s *orderService) GetStatusHistory(ctx context.Context, orderID int) (*StatusHistory, error) {
+	status, history, err := s.orderRepo.GetStatusHistory(ctx, orderID)
+	if err != nil {
+		err = domainError(err, fmt.Sprintf("order %d", orderID))
+		logError(ctx, s.log, "get status history", err, "order_id", orderID)
+
+		return nil, err
+	}
+
+	return &StatusHistory{OrderID: orderID, Status: status, History: history}, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"orders/src/broker"
+	"orders/src/db/models"
+	"orders/src/db/repositories"
+	"orders/src/logger"
+	"orders/src/mycache"
+	customvalidator "orders/src/utils/custom-validator"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to models.OrderStatus
+		allowed  bool
+	}{
+		{models.StatusCreated, models.StatusPaid, true},
+		{models.StatusCreated, models.StatusShipped, false},
+		{models.StatusPaid, models.StatusCancelled, true},
+		{models.StatusShipped, models.StatusCancelled, false},
+		{models.StatusShipped, models.StatusReturned, true},
+		{models.StatusDelivered, models.StatusReturned, true},
+		{models.StatusCancelled, models.StatusCreated, false},
+		{models.StatusReturned, models.StatusDelivered, false},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, c.allowed, CanTransition(c.from, c.to), "%s -> %s", c.from, c.to)
+	}
+}
+
+// statusRepo — репозиторий с заказом в заданном статусе; остальные методы не используются
+type statusRepo struct {
+	repositories.OrderRepository
+
+	status  models.OrderStatus
+	updated *models.StatusChange
+}
+
+func (r *statusRepo) GetOrderByID(_ context.Context, orderID int) (*broker.OrderMessage, error) {
+	return &broker.OrderMessage{Order: models.Order{ID: orderID, Status: r.status}}, nil
+}
+
+func (r *statusRepo) UpdateStatus(_ context.Context, change *models.StatusChange) (models.StatusChange, error) {
+	r.updated = change
+	return *change, nil
+}
+
+// deletedKeys — кеш, который запоминает удаленные ключи
+type deletedKeys struct {
+	mycache.CacheService
+
+	keys []string
+}
+
+func (c *deletedKeys) Delete(_ context.Context, key string) error {
+	c.keys = append(c.keys, key)
+	return nil
+}
+
+func newStatusService(t *testing.T, status models.OrderStatus) (*orderService, *statusRepo, *deletedKeys) {
+	valid, err := customvalidator.NewValidator()
+	require.NoError(t, err)
+
+	repo := &statusRepo{status: status}
+	cache := &deletedKeys{}
+
+	return &orderService{orderRepo: repo, myCache: cache, valid: valid, log: logger.Discard()}, repo, cache
+}
+
+func TestChangeStatus_InvalidatesCache(t *testing.T) {
+	s, repo, cache := newStatusService(t, models.StatusCreated)
+
+	change, err := s.ChangeStatus(context.Background(), 7, StatusChangeRequest{Status: models.StatusPaid, Actor: "support", Reason: "paid by card"})
+	require.NoError(t, err)
+
+	require.Equal(t, models.StatusCreated, change.From)
+	require.Equal(t, models.StatusPaid, change.To)
+	require.Equal(t, "support", repo.updated.Actor)
+	require.Equal(t, []string{orderCacheKey(7)}, cache.keys)
+}
+
+func TestChangeStatus_RejectsIllegalTransition(t *testing.T) {
+	s, repo, cache := newStatusService(t, models.StatusCancelled)
+
+	_, err := s.ChangeStatus(context.Background(), 7, StatusChangeRequest{Status: models.StatusPaid, Actor: "support"})
+	require.ErrorIs(t, err, ErrConflict)
+
+	require.Nil(t, repo.updated)
+	require.Empty(t, cache.keys)
+}
+
+func TestChangeStatus_Validation(t *testing.T) {
+	s, _, _ := newStatusService(t, models.StatusCreated)
+
+	_, err := s.ChangeStatus(context.Background(), 7, StatusChangeRequest{Status: "lost", Actor: "support"})
+	require.ErrorIs(t, err, ErrValidation)
+
+	_, err = s.ChangeStatus(context.Background(), 7, StatusChangeRequest{Status: models.StatusPaid})
+	require.ErrorIs(t, err, ErrValidation)
+}
@@ -2,17 +2,90 @@ package tracer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"orders/src/config"
+	"os"
 
-	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 )
 
+// Значения config.Tracer.Exporter
+const (
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
 type SpanExporter interface {
 	ExportSpans(ctx context.Context, spans []tracesdk.ReadOnlySpan) error
 	Shutdown(ctx context.Context) error
 }
 
-func NewExporter(url string) (SpanExporter, error) {
-	return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(url)))
+// NewExporter создает экспортер по cfg.Exporter. nil без ошибки — экспорт выключен: none или OTLP без endpoint
+func NewExporter(ctx context.Context, cfg config.Tracer) (SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterOTLPGRPC:
+		if cfg.Endpoint == "" {
+			return nil, nil
+		}
+
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		if cfg.Endpoint == "" {
+			return nil, nil
+		}
+
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		return newStdoutExporter(cfg.File)
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+}
+
+// fileExporter закрывает файл после остановки stdout-экспортера
+type fileExporter struct {
+	SpanExporter
+	file io.Closer
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
+
+func newStdoutExporter(path string) (SpanExporter, error) {
+	if path == "" {
+		return stdouttrace.New()
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open trace file: %w", err)
+	}
+
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
 
+	return fileExporter{SpanExporter: exp, file: file}, nil
 }
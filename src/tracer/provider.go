@@ -1,29 +1,49 @@
 package tracer
 
 import (
-	"go.opentelemetry.io/otel/attribute"
+	"orders/src/config"
+	"os"
+
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 )
 
-func NewTraceProvider(exp SpanExporter, ServiceName string) (*tracesdk.TracerProvider, error) {
-	// Ensure default SDK resources and the required service name are set.
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(ServiceName),
-			attribute.String("environment", "production"),
-			attribute.Int64("ID", 1),
-		),
-	)
+// NewTraceProvider создает провайдер с ratio-семплированием, учитывающим решение родителя.
+// exp = nil — спаны создаются (trace_id есть в логах и ответах), но никуда не отправляются
+func NewTraceProvider(exp SpanExporter, cfg config.Tracer) (*tracesdk.TracerProvider, error) {
+	r, err := newResource(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return tracesdk.NewTracerProvider(
-		tracesdk.WithBatcher(exp),
+	opts := []tracesdk.TracerProviderOption{
 		tracesdk.WithResource(r),
-	), nil
+		tracesdk.WithSampler(tracesdk.ParentBased(tracesdk.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+
+	if exp != nil {
+		opts = append(opts, tracesdk.WithBatcher(exp))
+	}
+
+	return tracesdk.NewTracerProvider(opts...), nil
+}
+
+func newResource(cfg config.Tracer) (*resource.Resource, error) {
+	instance := cfg.Instance
+
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	return resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(cfg.Version),
+			semconv.DeploymentEnvironmentName(cfg.Environment),
+			semconv.ServiceInstanceID(instance),
+		),
+	)
 }
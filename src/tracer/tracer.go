@@ -1,24 +1,31 @@
 package tracer
 
 import (
+	"context"
 	"fmt"
+	"orders/src/config"
 
 	"go.opentelemetry.io/otel"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 )
 
-func InitTracer(url string, serviceName string) (*tracesdk.TracerProvider, error) {
-	exporter, err := NewExporter(url)
-	if err != nil {
-		return nil, fmt.Errorf("initialize exporter: %w", err)
+// InitTracer настраивает глобальный провайдер трейсов. Провайдер возвращается всегда, даже вместе с ошибкой:
+// если экспортер не создался, спаны не отправляются, но сервис работает и может вызвать Shutdown
+func InitTracer(ctx context.Context, cfg config.Tracer) (*tracesdk.TracerProvider, error) {
+	exporter, exportErr := NewExporter(ctx, cfg)
+	if exportErr != nil {
+		exportErr = fmt.Errorf("initialize exporter: %w", exportErr)
+		exporter = nil
 	}
 
-	tp, err := NewTraceProvider(exporter, serviceName)
+	tp, err := NewTraceProvider(exporter, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("initialize provider: %w", err)
+		// Ресурс не собрался — провайдер без атрибутов лучше, чем nil
+		tp = tracesdk.NewTracerProvider()
+		exportErr = fmt.Errorf("initialize provider: %w", err)
 	}
 
-	otel.SetTracerProvider(tp) // !!!!!!!!!!!
+	otel.SetTracerProvider(tp)
 
-	return tp, nil
+	return tp, exportErr
 }
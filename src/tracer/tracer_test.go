@@ -0,0 +1,83 @@
+package tracer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orders/src/config"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testConfig() config.Tracer {
+	cfg := config.Default().Tracer
+	cfg.Instance = "test-1"
+
+	return cfg
+}
+
+func TestInitTracer_NoEndpointIsNoop(t *testing.T) {
+	ctx := context.Background()
+
+	tp, err := InitTracer(ctx, testConfig())
+	require.NoError(t, err)
+	require.NotNil(t, tp)
+
+	// Без экспортера спаны все равно получают trace_id для логов и ответов
+	_, span := tp.Tracer("test").Start(ctx, "op")
+	require.True(t, span.SpanContext().TraceID().IsValid())
+	span.End()
+
+	require.NoError(t, tp.Shutdown(ctx))
+}
+
+func TestInitTracer_StdoutToFile(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := testConfig()
+	cfg.Exporter = ExporterStdout
+	cfg.File = filepath.Join(t.TempDir(), "spans.json")
+
+	tp, err := InitTracer(ctx, cfg)
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(ctx, "handle-order")
+	span.End()
+
+	require.NoError(t, tp.Shutdown(ctx))
+
+	data, err := os.ReadFile(cfg.File)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"handle-order"`)
+	require.Contains(t, string(data), `"service.instance.id"`)
+}
+
+func TestNewTraceProvider_ParentBasedSampling(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := testConfig()
+	cfg.SampleRatio = 0
+
+	tp, err := NewTraceProvider(nil, cfg)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tp.Shutdown(ctx)) }()
+
+	_, root := tp.Tracer("test").Start(ctx, "root")
+	require.False(t, root.SpanContext().IsSampled())
+	root.End()
+
+	// Трейс, начатый выше по цепочке с семплированием, продолжается независимо от ratio
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	_, child := tp.Tracer("test").Start(trace.ContextWithRemoteSpanContext(ctx, parent), "child")
+	require.True(t, child.SpanContext().IsSampled())
+	child.End()
+}
@@ -1,7 +1,7 @@
 package customvalidator
 
 import (
-	"log"
+	"fmt"
 	"regexp"
 
 	"github.com/go-playground/validator/v10"
@@ -26,8 +26,7 @@ func NewValidator() (*validator.Validate, error) {
 	validate := validator.New(validator.WithRequiredStructEnabled()) // рекомендовано
 
 	if err := validate.RegisterValidation("zipcode", zipUS); err != nil {
-		log.Printf("ERROR IN validate.RegisterValidation: %v\n", err)
-		return &validator.Validate{}, err
+		return &validator.Validate{}, fmt.Errorf("register zipcode validation: %w", err)
 	}
 
 	return validate, nil
@@ -0,0 +1,16 @@
+package randomid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// New возвращает случайный идентификатор из n байт в hex
+func New(n int) string {
+	b := make([]byte, n)
+
+	// С Go 1.24 rand.Read не возвращает ошибку
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}